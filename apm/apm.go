@@ -0,0 +1,171 @@
+package apm
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"math"
+	"strings"
+)
+
+type DDM struct {
+	Sig       uint16
+	Blksz     uint16
+	Blkcnt    uint32
+	DevType   uint16
+	DevID     uint16
+	Data      uint32
+	DrvrCount uint16
+}
+
+type Driver struct {
+	Block uint32
+	Size  uint16
+	Type  uint16
+}
+
+type Entry struct {
+	Sig         uint16
+	_           uint16
+	MapBlkcnt   uint32
+	PyPartStart uint32
+	PartBlkcnt  uint32
+	Name        [32]byte
+	Type        [32]byte
+	LgDataStart uint32
+	DataCnt     uint32
+	Status      uint32
+	LgBootStart uint32
+	BootSize    uint32
+	BootAddr    uint32
+	BootAddr2   uint32
+	BootEntry   uint32
+	BootEntry2  uint32
+	BootCksum   uint32
+	Processor   [16]byte
+}
+
+type Map struct {
+	DDM     DDM
+	Drivers []Driver
+	Blksz   int
+	Entries []Entry
+}
+
+const (
+	DDMSig   = 0x4552 // ER
+	EntrySig = 0x504d // PM
+
+	maxDrivers = 61
+	maxEntries = 1024
+)
+
+const (
+	StatusValid       = 1 << 0
+	StatusAllocated   = 1 << 1
+	StatusInUse       = 1 << 2
+	StatusBootable    = 1 << 3
+	StatusReadable    = 1 << 4
+	StatusWritable    = 1 << 5
+	StatusPICBoot     = 1 << 6
+	StatusChainCompat = 1 << 8
+	StatusRealDriver  = 1 << 9
+	StatusChainDriver = 1 << 10
+	StatusAutoMount   = 1 << 30
+	StatusStartup     = 1 << 31
+)
+
+var (
+	ErrHeader = errors.New("apm: invalid driver descriptor map")
+	ErrEntry  = errors.New("apm: invalid partition map entry")
+)
+
+func Open(r io.ReaderAt) (*Map, error) {
+	m := &Map{}
+
+	sr := io.NewSectionReader(r, 0, math.MaxUint32)
+	err := binary.Read(sr, binary.BigEndian, &m.DDM)
+	if err != nil {
+		return nil, err
+	}
+	if m.DDM.Sig != DDMSig {
+		return nil, ErrHeader
+	}
+
+	ndrv := int(m.DDM.DrvrCount)
+	if ndrv > maxDrivers {
+		ndrv = maxDrivers
+	}
+	for i := 0; i < ndrv; i++ {
+		var d Driver
+		err = binary.Read(sr, binary.BigEndian, &d)
+		if err != nil {
+			return nil, err
+		}
+		m.Drivers = append(m.Drivers, d)
+	}
+
+	// hybrid CD images claim a 2048 byte block size in the DDM
+	// but some of them still lay out the map in 512 byte blocks
+	m.Blksz = int(m.DDM.Blksz)
+	if m.Blksz == 0 {
+		m.Blksz = 512
+	}
+	e, err := readEntry(r, int64(m.Blksz))
+	if err == ErrEntry && m.Blksz != 512 {
+		m.Blksz = 512
+		e, err = readEntry(r, int64(m.Blksz))
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	n := int(e.MapBlkcnt)
+	if n > maxEntries {
+		n = maxEntries
+	}
+	m.Entries = append(m.Entries, e)
+	for i := 2; i <= n; i++ {
+		e, err = readEntry(r, int64(i*m.Blksz))
+		if err != nil {
+			return nil, err
+		}
+		m.Entries = append(m.Entries, e)
+	}
+
+	return m, nil
+}
+
+func readEntry(r io.ReaderAt, off int64) (Entry, error) {
+	var e Entry
+	sr := io.NewSectionReader(r, off, math.MaxUint32)
+	err := binary.Read(sr, binary.BigEndian, &e)
+	if err != nil {
+		return e, err
+	}
+	if e.Sig != EntrySig {
+		return e, ErrEntry
+	}
+	return e, nil
+}
+
+func (e *Entry) Label() string    { return cstr(e.Name[:]) }
+func (e *Entry) TypeName() string { return cstr(e.Type[:]) }
+
+func (e *Entry) FirstBlock() uint64 { return uint64(e.PyPartStart) }
+
+func (e *Entry) LastBlock() uint64 {
+	if e.PartBlkcnt == 0 {
+		return uint64(e.PyPartStart)
+	}
+	return uint64(e.PyPartStart) + uint64(e.PartBlkcnt) - 1
+}
+
+func cstr(b []byte) string {
+	s := string(b)
+	i := strings.IndexByte(s, 0)
+	if i >= 0 {
+		s = s[:i]
+	}
+	return s
+}
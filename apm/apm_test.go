@@ -0,0 +1,96 @@
+package apm
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func loadImage(t *testing.T, name string) []byte {
+	t.Helper()
+	f, err := os.Open(filepath.Join("testdata", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	z, err := gzip.NewReader(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := io.ReadAll(z)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func TestOpen(t *testing.T) {
+	tests := []struct {
+		name  string
+		ddmsz uint16
+		blksz int
+	}{
+		{"apm512.img.gz", 512, 512},
+		{"apm2048.img.gz", 2048, 2048},
+		{"hybrid.img.gz", 2048, 512},
+	}
+	for _, tt := range tests {
+		m, err := Open(bytes.NewReader(loadImage(t, tt.name)))
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if m.DDM.Blksz != tt.ddmsz || m.Blksz != tt.blksz {
+			t.Errorf("%s: block size %d in the DDM, %d used, want %d %d", tt.name, m.DDM.Blksz, m.Blksz, tt.ddmsz, tt.blksz)
+		}
+		if len(m.Drivers) != 1 || m.Drivers[0] != (Driver{64, 4, 0x701}) {
+			t.Errorf("%s: drivers %+v", tt.name, m.Drivers)
+		}
+		if len(m.Entries) != 3 {
+			t.Fatalf("%s: %d entries, want 3", tt.name, len(m.Entries))
+		}
+
+		e := &m.Entries[1]
+		if e.Label() != "Macintosh HD" || e.TypeName() != "Apple_HFS" {
+			t.Errorf("%s: entry 2 is %q %q", tt.name, e.Label(), e.TypeName())
+		}
+		if e.FirstBlock() != 64 || e.LastBlock() != 1063 {
+			t.Errorf("%s: entry 2 spans %d-%d", tt.name, e.FirstBlock(), e.LastBlock())
+		}
+		if e.Status&(StatusValid|StatusAllocated|StatusReadable|StatusWritable|StatusAutoMount) != e.Status {
+			t.Errorf("%s: entry 2 status %#x", tt.name, e.Status)
+		}
+		if m.Entries[2].TypeName() != "Apple_Free" {
+			t.Errorf("%s: entry 3 is %q", tt.name, m.Entries[2].TypeName())
+		}
+	}
+}
+
+func TestOpenBad(t *testing.T) {
+	img := loadImage(t, "apm512.img.gz")
+	img[0] = 0
+	if _, err := Open(bytes.NewReader(img)); err != ErrHeader {
+		t.Errorf("bad DDM signature: got %v, want %v", err, ErrHeader)
+	}
+
+	img = loadImage(t, "apm512.img.gz")
+	img[512] = 0
+	if _, err := Open(bytes.NewReader(img)); err != ErrEntry {
+		t.Errorf("bad first entry signature: got %v, want %v", err, ErrEntry)
+	}
+
+	img = loadImage(t, "apm512.img.gz")
+	img[3*512+1] = 0
+	if _, err := Open(bytes.NewReader(img)); err != ErrEntry {
+		t.Errorf("bad last entry signature: got %v, want %v", err, ErrEntry)
+	}
+
+	// a map that claims more entries than the disk holds
+	img = loadImage(t, "apm512.img.gz")[:4*512]
+	img[512+4], img[512+5], img[512+6], img[512+7] = 0, 0, 0, 8
+	if _, err := Open(bytes.NewReader(img)); err == nil {
+		t.Error("truncated map opened")
+	}
+}
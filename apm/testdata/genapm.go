@@ -0,0 +1,75 @@
+//go:build ignore
+
+// genapm writes Apple Partition Map test images without using the apm
+// package:
+//
+//	apm512.img.gz   512 byte blocks, a driver and three map entries
+//	apm2048.img.gz  2048 byte blocks throughout
+//	hybrid.img.gz   a DDM claiming 2048 byte blocks over a 512 byte map,
+//	                the way hybrid ISO images are laid out
+//
+//	go run genapm.go
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"log"
+	"os"
+)
+
+type entry struct {
+	name, typ    string
+	start, count uint32
+	status       uint32
+}
+
+var entries = []entry{
+	{"Apple", "Apple_partition_map", 1, 63, 0x3},
+	{"Macintosh HD", "Apple_HFS", 64, 1000, 0x40000033},
+	{"Extra", "Apple_Free", 1064, 24, 0},
+}
+
+func main() {
+	log.SetFlags(0)
+	write("apm512.img.gz", 512, 512)
+	write("apm2048.img.gz", 2048, 2048)
+	write("hybrid.img.gz", 2048, 512)
+}
+
+// ddmsz goes in the driver descriptor map, blksz is what the map uses
+func write(name string, ddmsz, blksz int) {
+	img := make([]byte, 1088*blksz)
+	be := binary.BigEndian
+
+	be.PutUint16(img[0:], 0x4552)
+	be.PutUint16(img[2:], uint16(ddmsz))
+	be.PutUint32(img[4:], uint32(len(img)/ddmsz))
+	be.PutUint16(img[16:], 1)
+	be.PutUint32(img[18:], 64)
+	be.PutUint16(img[22:], 4)
+	be.PutUint16(img[24:], 0x701)
+
+	for i, e := range entries {
+		b := img[(i+1)*blksz:]
+		be.PutUint16(b[0:], 0x504d)
+		be.PutUint32(b[4:], uint32(len(entries)))
+		be.PutUint32(b[8:], e.start)
+		be.PutUint32(b[12:], e.count)
+		copy(b[16:48], e.name)
+		copy(b[48:80], e.typ)
+		be.PutUint32(b[84:], e.count)
+		be.PutUint32(b[88:], e.status)
+		copy(b[120:], "powerpc")
+	}
+
+	var buf bytes.Buffer
+	w, _ := gzip.NewWriterLevel(&buf, gzip.BestCompression)
+	w.Write(img)
+	w.Close()
+	err := os.WriteFile(name, buf.Bytes(), 0644)
+	if err != nil {
+		log.Fatal(err)
+	}
+}
@@ -7,14 +7,19 @@ import (
 	"os"
 	"strings"
 
+	"github.com/qeedquan/disktools/apm"
+	"github.com/qeedquan/disktools/disklabel"
 	"github.com/qeedquan/disktools/endian"
 	"github.com/qeedquan/disktools/gpt"
+	"github.com/qeedquan/disktools/layout"
 	"github.com/qeedquan/disktools/mbr"
 )
 
 func main() {
 	log.SetFlags(0)
 
+	verify := flag.Bool("v", false, "verify GPT checksums and backup header")
+	align := flag.Uint64("a", layout.DefaultAlign, "alignment in bytes to check partitions against")
 	flag.Usage = usage
 	flag.Parse()
 	if flag.NArg() < 1 {
@@ -37,15 +42,30 @@ func main() {
 
 	for _, p := range parts {
 		switch p := p.(type) {
-		case *mbr.Record:
+		case *mbrDisk:
 			printMBR(p)
+			lr, err := layout.MBR(p.Record, fi.Size(), *align)
+			ck(err)
+			printLayout(lr)
 		case *gpt.Table:
 			printGPT(p)
+			printLayout(layout.GPT(p, *align))
+		case *apm.Map:
+			printAPM(p)
+		case *disklabel.Label:
+			fmt.Printf("%v\n", p.Kind)
+			printSpaces()
+			printLabel(p, "")
+			printSpaces()
 		default:
 			panic("unreachable")
 		}
 		fmt.Println()
 	}
+
+	if *verify {
+		ck(verifyGPT(name))
+	}
 }
 
 func usage() {
@@ -60,6 +80,11 @@ func ck(err error) {
 	}
 }
 
+type mbrDisk struct {
+	*mbr.Record
+	labels map[int]*disklabel.Label
+}
+
 func discover(name string) ([]interface{}, error) {
 	f, err := os.Open(name)
 	if err != nil {
@@ -70,7 +95,7 @@ func discover(name string) ([]interface{}, error) {
 	var parts []interface{}
 	mbr, err := mbr.Open(f)
 	if err == nil {
-		parts = append(parts, mbr)
+		parts = append(parts, &mbrDisk{mbr, disklabel.OpenMBR(f, mbr)})
 	}
 
 	gpt, err := gpt.Open(f, nil)
@@ -78,56 +103,191 @@ func discover(name string) ([]interface{}, error) {
 		parts = append(parts, gpt)
 	}
 
+	apm, err := apm.Open(f)
+	if err == nil {
+		parts = append(parts, apm)
+	}
+
+	sun, err := disklabel.ReadSun(f, 0)
+	if err == nil {
+		parts = append(parts, sun)
+	}
+
 	return parts, nil
 }
 
-func printSpaces() {
-	fmt.Printf("%s\n", strings.Repeat("-", 80))
+func verifyGPT(name string) error {
+	f, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	fs, err := gpt.Verify(f, nil)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("GPT Verification\n")
+	printSpaces()
+	if len(fs) == 0 {
+		fmt.Println("No problems found")
+	}
+	for _, f := range fs {
+		fmt.Println(f)
+	}
+	printSpaces()
+	return nil
 }
 
-func printMBR(p *mbr.Record) {
-	empty := func(i int) bool {
-		c := &p.Part[i]
-		return c.FirstLBA == 0 || c.NumSectors == 0
+func printAPM(p *apm.Map) {
+	d := &p.DDM
+
+	fmt.Printf("Apple Partition Map\n")
+	printSpaces()
+	fmt.Printf("Driver Descriptor Map\n")
+	fmt.Printf("  Block size:  %d\n", d.Blksz)
+	fmt.Printf("  Block count: %d\n", d.Blkcnt)
+	fmt.Printf("  Device type: %#x\n", d.DevType)
+	fmt.Printf("  Device ID:   %#x\n", d.DevID)
+	fmt.Printf("  Drivers:     %d\n", d.DrvrCount)
+	for i, v := range p.Drivers {
+		fmt.Printf("    Driver %d: block %d size %d type %#x\n", i+1, v.Block, v.Size, v.Type)
 	}
+	fmt.Printf("\n")
+
+	blksz := uint64(p.Blksz)
+	for i := range p.Entries {
+		c := &p.Entries[i]
+		size := uint64(c.PartBlkcnt)
 
-	protective := false
-	if p.Part[0].Type == 0xee && !empty(0) && empty(1) && empty(2) && empty(3) {
-		protective = true
+		fmt.Printf("Partition %d\n", i+1)
+		fmt.Printf("  Name:           %s\n", c.Label())
+		fmt.Printf("  Type:           %s\n", c.TypeName())
+		fmt.Printf("  First block:    %d (%#x) (at %s)\n",
+			c.FirstBlock(), c.FirstBlock()*blksz, endian.IEEE1541frombits(c.FirstBlock()*blksz))
+		fmt.Printf("  Last block:     %d (%#x) (at %s)\n",
+			c.LastBlock(), c.LastBlock()*blksz, endian.IEEE1541frombits(c.LastBlock()*blksz))
+		fmt.Printf("  Partition size: %d blocks (%s)\n",
+			size, endian.IEEE1541frombits(size*blksz))
+		fmt.Printf("  Status:         %#x\n", c.Status)
+		if c.Processor[0] != 0 {
+			fmt.Printf("  Processor:      %s\n", strings.TrimRight(string(c.Processor[:]), "\x00"))
+		}
+		fmt.Printf("\n")
 	}
+	printSpaces()
+}
 
-	if !protective {
-		fmt.Printf("MBR Partition\n")
-	} else {
+func printLayout(r *layout.Report) {
+	sectsz := uint64(r.Sectsz)
+	free := r.FreeSectors()
+
+	fmt.Printf("Free Space\n")
+	printSpaces()
+	fmt.Printf("Usable sectors:  %d-%d\n", r.First, r.Last)
+	fmt.Printf("Free sectors:    %d (%s) in %d extents\n",
+		free, endian.IEEE1541frombits(free*sectsz), len(r.Free))
+	for _, e := range r.Free {
+		fmt.Printf("  %d-%d (%s)\n", e.First, e.Last, endian.IEEE1541frombits(e.Size()*sectsz))
+	}
+	if free > 0 {
+		fmt.Printf("Largest extent:  %d-%d (%s)\n",
+			r.Largest.First, r.Largest.Last, endian.IEEE1541frombits(r.Largest.Size()*sectsz))
+	}
+	for _, m := range r.Misaligned {
+		fmt.Printf("Warning: partition %d at sector %d is not aligned to %s\n",
+			m.Num, m.First, endian.IEEE1541frombits(r.Align))
+	}
+	printSpaces()
+}
+
+func printSpaces() {
+	fmt.Printf("%s\n", strings.Repeat("-", 80))
+}
+
+func printMBR(p *mbrDisk) {
+	switch gpt.ClassifyMBR(p.Record) {
+	case gpt.ProtectiveMBR:
 		fmt.Printf("MBR Partition (Protective)\n")
+	case gpt.HybridMBR:
+		fmt.Printf("MBR Partition (Hybrid)\n")
+	default:
+		fmt.Printf("MBR Partition\n")
 	}
 
 	printSpaces()
-	if len(p.Part) == 0 {
-		fmt.Println("No active partitions")
+	fmt.Printf("Disk signature: 0x%08x\n", p.Sig)
+	if p.Protect == 0x5a5a {
+		fmt.Printf("Copy protected\n")
 	}
-
+	fmt.Printf("\n")
+	active := 0
 	for i, c := range p.Part {
-		size := (c.LastLBA - uint64(c.FirstLBA) + 1)
+		if c.Empty() {
+			continue
+		}
+		printMBRPart(p, i+1, &c)
+		active++
+	}
+	if active == 0 {
+		fmt.Println("No active partitions")
+	}
+	for i, c := range p.Logical {
+		printMBRPart(p, i+5, &c)
+	}
+	if p.ChainErr != nil {
+		fmt.Printf("Warning: logical partitions: %v\n", p.ChainErr)
+	}
 
-		fmt.Printf("Partition %d\n", i+1)
-		fmt.Printf("  Bootable:       %b\n", c.Bootable)
-		fmt.Printf("  Type:           %#x (%s)\n", c.Type, mbr.Types[c.Type])
-		fmt.Printf("  First sector:   %d (%#x) (at %s)\n",
-			c.FirstLBA, c.FirstLBA*uint32(p.Sectsz), endian.IEEE1541frombits(uint64(c.FirstLBA)*uint64(p.Sectsz)))
-		fmt.Printf("  Last sector:    %d (%#x) (at %s)\n",
-			c.LastLBA, c.LastLBA*uint64(p.Sectsz), endian.IEEE1541frombits(uint64(c.LastLBA)*uint64(p.Sectsz)))
-		fmt.Printf("  Partition size: %d sectors (%s)\n",
-			size, endian.IEEE1541frombits(size*uint64(p.Sectsz)))
-		fmt.Printf("  Start CHS:      (%d,%d,%d)\n",
-			c.Start.Head, c.Start.Sector, c.Start.Cylinder)
-		fmt.Printf("  End CHS:        (%d,%d,%d)\n",
-			c.End.Head, c.End.Sector, c.End.Cylinder)
-		fmt.Printf("\n")
+	if g, ok := p.InferGeometry(); ok {
+		m, _ := p.CheckCHS(&g)
+		for _, m := range m {
+			fmt.Printf("Warning: %v\n", &m)
+		}
 	}
 	printSpaces()
 }
 
+func printMBRPart(p *mbrDisk, n int, c *mbr.Part) {
+	size := (c.LastLBA - uint64(c.FirstLBA) + 1)
+
+	fmt.Printf("Partition %d\n", n)
+	fmt.Printf("  PARTUUID:       %s\n", p.PartUUID(n))
+	fmt.Printf("  Bootable:       %b\n", c.Bootable)
+	fmt.Printf("  Type:           %#x (%s)\n", c.Type, mbr.Types[c.Type])
+	fmt.Printf("  First sector:   %d (%#x) (at %s)\n",
+		c.FirstLBA, c.FirstLBA*uint32(p.Sectsz), endian.IEEE1541frombits(uint64(c.FirstLBA)*uint64(p.Sectsz)))
+	fmt.Printf("  Last sector:    %d (%#x) (at %s)\n",
+		c.LastLBA, c.LastLBA*uint64(p.Sectsz), endian.IEEE1541frombits(uint64(c.LastLBA)*uint64(p.Sectsz)))
+	fmt.Printf("  Partition size: %d sectors (%s)\n",
+		size, endian.IEEE1541frombits(size*uint64(p.Sectsz)))
+	fmt.Printf("  Start CHS:      (%d,%d,%d)\n",
+		c.Start.Cylinder, c.Start.Head, c.Start.Sector)
+	fmt.Printf("  End CHS:        (%d,%d,%d)\n",
+		c.End.Cylinder, c.End.Head, c.End.Sector)
+	if l := p.labels[n]; l != nil {
+		fmt.Printf("  %v\n", l.Kind)
+		printLabel(l, "    ")
+	}
+	fmt.Printf("\n")
+}
+
+func printLabel(l *disklabel.Label, indent string) {
+	sectsz := uint64(l.Sectsz)
+	if l.Name != "" {
+		fmt.Printf("%sName:     %s\n", indent, l.Name)
+	}
+	if !l.ChecksumOK {
+		fmt.Printf("%sWarning: bad label checksum\n", indent)
+	}
+	for i := range l.Slices {
+		s := &l.Slices[i]
+		fmt.Printf("%sSlice %s: %d-%d (%s) %s\n", indent, l.SliceName(s),
+			s.First, s.Last(), endian.IEEE1541frombits(s.Size*sectsz), l.TagName(s))
+	}
+}
+
 func printGPT(p *gpt.Table) {
 	h := &p.Header
 
@@ -135,6 +295,7 @@ func printGPT(p *gpt.Table) {
 	printSpaces()
 	fmt.Printf("Header\n")
 	fmt.Printf("  GUID:        %v\n", h.GUID)
+	fmt.Printf("  Sector size: %v\n", p.Sectsz)
 	fmt.Printf("  Header size: %v\n", h.Hdrsz)
 	fmt.Printf("  Header CRC:  %#x\n", h.Hdrcrc)
 	fmt.Printf("  Current LBA: %v\n", h.Current)
@@ -144,5 +305,65 @@ func printGPT(p *gpt.Table) {
 	fmt.Printf("  Entries:     %v\n", h.Ent)
 	fmt.Printf("  Entrie size: %v\n", h.Entsz)
 	fmt.Printf("  Table CRC:   %#x\n", h.Tabcrc)
+	fmt.Printf("\n")
+
+	active := 0
+	for i := range p.Entries {
+		c := &p.Entries[i]
+		if c.Empty() {
+			continue
+		}
+		printGPTPart(p, i+1, c)
+		active++
+	}
+	if active == 0 {
+		fmt.Println("No active partitions")
+	}
+
+	hm := p.Hybrid()
+	for _, s := range hm.Slots {
+		if s.Entry >= 0 {
+			fmt.Printf("Hybrid MBR slot %d maps to partition %d\n", s.Slot+1, s.Entry+1)
+		}
+	}
+	for _, w := range hm.Warnings {
+		fmt.Printf("Warning: %s\n", w)
+	}
 	printSpaces()
 }
+
+func printGPTPart(p *gpt.Table, n int, c *gpt.Entry) {
+	sectsz := uint64(p.Sectsz)
+	size := c.Size()
+
+	fmt.Printf("Partition %d\n", n)
+	fmt.Printf("  Name:           %s\n", c.Label())
+	fmt.Printf("  Type:           %v (%s)\n", c.Part, c.TypeName())
+	fmt.Printf("  Unique GUID:    %v\n", c.Uniq)
+	fmt.Printf("  First sector:   %d (%#x) (at %s)\n",
+		c.First, c.First*sectsz, endian.IEEE1541frombits(c.First*sectsz))
+	fmt.Printf("  Last sector:    %d (%#x) (at %s)\n",
+		c.Last, c.Last*sectsz, endian.IEEE1541frombits(c.Last*sectsz))
+	fmt.Printf("  Partition size: %d sectors (%s)\n",
+		size, endian.IEEE1541frombits(size*sectsz))
+	fmt.Printf("  Attributes:     %#x", c.Attr)
+	var attrs []string
+	if c.Required() {
+		attrs = append(attrs, "required")
+	}
+	if c.NoBlockIO() {
+		attrs = append(attrs, "no block io")
+	}
+	if c.LegacyBootable() {
+		attrs = append(attrs, "legacy bios bootable")
+	}
+	if len(attrs) > 0 {
+		fmt.Printf(" (%s)", strings.Join(attrs, ", "))
+	}
+	fmt.Printf("\n")
+	if c.IsChromeOSKernel() {
+		fmt.Printf("  ChromeOS:       priority=%d tries=%d successful=%v\n",
+			c.Priority(), c.Tries(), c.Successful())
+	}
+	fmt.Printf("\n")
+}
@@ -1,41 +1,97 @@
 package main
 
 import (
+	"errors"
 	"flag"
 	"fmt"
+	"io"
+	"io/fs"
 	"log"
 	"os"
+	"path"
+	"path/filepath"
+	"strings"
 
 	"github.com/qeedquan/disktools/fat"
+	"github.com/qeedquan/disktools/gpt"
 	"github.com/qeedquan/disktools/iod"
+	"github.com/qeedquan/disktools/mbr"
+)
+
+type volume struct {
+	fat  *fat.FileSystem
+	ex   *fat.ExFileSystem
+	fsys fs.FS
+}
+
+var (
+	case_  = flag.Bool("c", false, "case sensitive")
+	offset = flag.Int64("o", -1, "byte offset of the filesystem, overrides -p")
+	part   = flag.Int("p", 0, "partition index in the MBR or GPT, 0 uses the whole image")
 )
 
 func main() {
 	log.SetFlags(0)
 	log.SetPrefix("fatimg: ")
 
-	case_ := flag.Bool("c", false, "case sensitive")
-	offset := flag.Int64("o", 0x7e00, "offset to start reading")
 	flag.Usage = usage
 	flag.Parse()
 	if flag.NArg() < 1 {
 		usage()
 	}
 
-	fd, err := os.Open(flag.Arg(0))
+	cmd, args := "info", []string(nil)
+	if flag.NArg() > 1 {
+		cmd, args = flag.Arg(1), flag.Args()[2:]
+	}
+
+	mode := os.O_RDONLY
+	if cmd == "put" || cmd == "rm" {
+		mode = os.O_RDWR
+	}
+	fd, err := os.OpenFile(flag.Arg(0), mode, 0)
 	ck(err)
+	defer fd.Close()
 
-	rw := iod.NewORW(fd, *offset)
-	opt := &fat.FileSystemOptions{
-		Case: *case_,
+	off := *offset
+	if off < 0 {
+		off, err = partOffset(fd, *part)
+		ck(err)
 	}
-	_, err = fat.NewFileSystem(rw, opt)
+	v, err := openVolume(iod.NewORW(fd, off))
 	ck(err)
+
+	switch cmd {
+	case "info":
+		info(v)
+	case "ls":
+		ls(v, args)
+	case "cat":
+		cat(v, args)
+	case "tree":
+		tree(v, args)
+	case "extract":
+		extract(v, args)
+	case "put":
+		put(v, args)
+	case "rm":
+		rm(v, args)
+	default:
+		log.Fatalf("unknown command %q", cmd)
+	}
 }
 
 func usage() {
-	fmt.Fprintln(os.Stderr, "usage: fatimg [options] file")
+	fmt.Fprintln(os.Stderr, "usage: fatimg [options] image [command] [args]")
 	flag.PrintDefaults()
+	fmt.Fprintln(os.Stderr, " commands:")
+	fmt.Fprintln(os.Stderr, "  info                 - show the filesystem parameters (default)")
+	fmt.Fprintln(os.Stderr, "  ls [-l] [path...]    - list directories")
+	fmt.Fprintln(os.Stderr, "  cat path...          - print files")
+	fmt.Fprintln(os.Stderr, "  tree [path]          - print the directory tree")
+	fmt.Fprintln(os.Stderr, "  extract [path] dir   - copy a file or directory tree out to dir")
+	fmt.Fprintln(os.Stderr, "  put file... path     - copy host files into the image")
+	fmt.Fprintln(os.Stderr, "  rm [-r] path...      - remove files or directories")
 	os.Exit(2)
 }
 
@@ -44,3 +100,369 @@ func ck(err error) {
 		log.Fatal(err)
 	}
 }
+
+// partOffset finds the byte offset of partition n, GPT entries are numbered
+// by their slot, MBR logical partitions start at 5
+func partOffset(r io.ReaderAt, n int) (int64, error) {
+	if n == 0 {
+		return 0, nil
+	}
+
+	if t, err := gpt.Open(r, nil); err == nil {
+		if n > len(t.Entries) || t.Entries[n-1].Empty() {
+			return 0, fmt.Errorf("GPT partition %d does not exist", n)
+		}
+		return int64(t.Entries[n-1].First) * int64(t.Sectsz), nil
+	}
+
+	m, err := mbr.Open(r)
+	if err != nil {
+		return 0, err
+	}
+
+	var p *mbr.Part
+	switch {
+	case n <= len(m.Part):
+		p = &m.Part[n-1]
+	case n >= 5 && n-5 < len(m.Logical):
+		p = &m.Logical[n-5]
+	}
+	if p == nil || p.Empty() {
+		return 0, fmt.Errorf("MBR partition %d does not exist", n)
+	}
+	return int64(p.FirstLBA) * int64(m.Sectsz), nil
+}
+
+func openVolume(rw iod.RW) (*volume, error) {
+	opt := &fat.FileSystemOptions{
+		Case: *case_,
+	}
+
+	v := &volume{}
+	var err error
+	v.fat, err = fat.NewFileSystem(rw, opt)
+	if err == fat.ErrExFAT {
+		v.ex, err = fat.NewExFileSystem(rw, opt)
+		if err != nil {
+			return nil, err
+		}
+		v.fsys = fat.NewExFS(v.ex)
+		return v, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	v.fsys = fat.NewFS(v.fat)
+	return v, nil
+}
+
+// fsPath turns a path given on the command line into an io/fs name
+func fsPath(name string) string {
+	name = strings.Trim(path.Clean("/"+name), "/")
+	if name == "" {
+		return "."
+	}
+	return name
+}
+
+func info(v *volume) {
+	if v.ex != nil {
+		fmt.Println(v.ex)
+	} else {
+		fmt.Println(v.fat)
+	}
+}
+
+func ls(v *volume, args []string) {
+	flags := flag.NewFlagSet("ls", flag.ExitOnError)
+	long := flags.Bool("l", false, "long listing with attributes and timestamps")
+	flags.Parse(args)
+
+	args = flags.Args()
+	if len(args) == 0 {
+		args = []string{"/"}
+	}
+	for i, name := range args {
+		fi, err := fs.Stat(v.fsys, fsPath(name))
+		ck(err)
+
+		if !fi.IsDir() {
+			lsEntry(fi, *long)
+			continue
+		}
+
+		if len(args) > 1 {
+			if i > 0 {
+				fmt.Println()
+			}
+			fmt.Printf("%s:\n", name)
+		}
+		ents, err := fs.ReadDir(v.fsys, fsPath(name))
+		ck(err)
+		for _, e := range ents {
+			fi, err := e.Info()
+			ck(err)
+			lsEntry(fi, *long)
+		}
+	}
+}
+
+func lsEntry(fi fs.FileInfo, long bool) {
+	name := fi.Name()
+	if fi.IsDir() {
+		name += "/"
+	}
+	if !long {
+		fmt.Println(name)
+		return
+	}
+	fmt.Printf("%s %10d %s %s\n", attrString(fi), fi.Size(), fi.ModTime().Format("2006-01-02 15:04:05"), name)
+}
+
+func attrString(fi fs.FileInfo) string {
+	a, ok := fi.Sys().(*fat.Attr)
+	if !ok {
+		return "-----"
+	}
+
+	b := []byte("-----")
+	for i, c := range []struct {
+		set  bool
+		char byte
+	}{
+		{a.IsDir(), 'd'},
+		{a.ReadOnly(), 'r'},
+		{a.Hidden(), 'h'},
+		{a.System(), 's'},
+		{a.Archive(), 'a'},
+	} {
+		if c.set {
+			b[i] = c.char
+		}
+	}
+	return string(b)
+}
+
+func cat(v *volume, args []string) {
+	for _, name := range args {
+		f, err := v.fsys.Open(fsPath(name))
+		ck(err)
+		_, err = io.Copy(os.Stdout, f)
+		f.Close()
+		ck(err)
+	}
+}
+
+func tree(v *volume, args []string) {
+	root := "/"
+	if len(args) > 0 {
+		root = args[0]
+	}
+	fmt.Println(root)
+	ck(treeDir(v.fsys, fsPath(root), ""))
+}
+
+func treeDir(fsys fs.FS, name, prefix string) error {
+	ents, err := fs.ReadDir(fsys, name)
+	if err != nil {
+		return err
+	}
+	for i, e := range ents {
+		branch, next := "├── ", "│   "
+		if i == len(ents)-1 {
+			branch, next = "└── ", "    "
+		}
+		fmt.Printf("%s%s%s\n", prefix, branch, e.Name())
+		if e.IsDir() {
+			err = treeDir(fsys, path.Join(name, e.Name()), prefix+next)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func extract(v *volume, args []string) {
+	src, dst := ".", ""
+	switch len(args) {
+	case 1:
+		dst = args[0]
+	case 2:
+		src, dst = fsPath(args[0]), args[1]
+	default:
+		usage()
+	}
+
+	// directory times are set last since writing files into them changes it
+	type dirTime struct {
+		name string
+		fi   fs.FileInfo
+	}
+	var dirs []dirTime
+
+	err := fs.WalkDir(v.fsys, src, func(name string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		// names come from the image and could walk out of dst
+		if name != src && !localName(d.Name()) {
+			return fmt.Errorf("%s: refusing to extract %q", name, d.Name())
+		}
+
+		rel := ""
+		switch {
+		case name == src && d.IsDir():
+		case name == src:
+			rel = path.Base(name)
+		case src == ".":
+			rel = name
+		default:
+			rel = strings.TrimPrefix(name, src+"/")
+		}
+		if rel != "" && !filepath.IsLocal(filepath.FromSlash(rel)) {
+			return fmt.Errorf("%s: refusing to extract outside of %s", name, dst)
+		}
+		out := filepath.Join(dst, filepath.FromSlash(rel))
+
+		fi, err := d.Info()
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			if rel != "" {
+				dirs = append(dirs, dirTime{out, fi})
+			}
+			return os.MkdirAll(out, 0755)
+		}
+
+		err = copyOut(v.fsys, name, out, fi)
+		if err == nil {
+			err = os.Chtimes(out, fi.ModTime(), fi.ModTime())
+		}
+		return err
+	})
+	ck(err)
+
+	for i := len(dirs) - 1; i >= 0; i-- {
+		ck(os.Chtimes(dirs[i].name, dirs[i].fi.ModTime(), dirs[i].fi.ModTime()))
+	}
+}
+
+// localName reports if a directory entry name is a single path element
+func localName(name string) bool {
+	return name != "" && name != "." && name != ".." && !strings.ContainsAny(name, `/\`)
+}
+
+func copyOut(fsys fs.FS, name, out string, fi fs.FileInfo) error {
+	r, err := fsys.Open(name)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	err = os.MkdirAll(filepath.Dir(out), 0755)
+	if err != nil {
+		return err
+	}
+	w, err := os.OpenFile(out, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, fi.Mode().Perm()|0200)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(w, r)
+	xerr := w.Close()
+	if err == nil {
+		err = xerr
+	}
+	return err
+}
+
+func put(v *volume, args []string) {
+	if v.fat == nil {
+		ck(errors.New("exfat volumes are read-only"))
+	}
+	if len(args) < 2 {
+		usage()
+	}
+
+	dst := "/" + fsPath(args[len(args)-1])
+	srcs := args[:len(args)-1]
+	fi, err := v.fat.Stat(dst)
+	isdir := err == nil && fi.IsDir()
+	if len(srcs) > 1 && !isdir {
+		ck(fmt.Errorf("%s: not a directory", dst))
+	}
+
+	for _, src := range srcs {
+		out := dst
+		if isdir {
+			out = path.Join(dst, filepath.Base(src))
+		}
+		ck(putPath(v.fat, src, out))
+	}
+}
+
+func putPath(fsys *fat.FileSystem, src, dst string) error {
+	fi, err := os.Stat(src)
+	if err != nil {
+		return err
+	}
+
+	if fi.IsDir() {
+		err = fsys.MkdirAll(dst, 0755)
+		if err != nil {
+			return err
+		}
+		ents, err := os.ReadDir(src)
+		if err != nil {
+			return err
+		}
+		for _, e := range ents {
+			err = putPath(fsys, filepath.Join(src, e.Name()), path.Join(dst, e.Name()))
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	r, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	w, err := fsys.Create(dst)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(w, r)
+	xerr := w.Close()
+	if err == nil {
+		err = xerr
+	}
+	if err != nil {
+		return err
+	}
+	return fsys.Chtimes(dst, fi.ModTime(), fi.ModTime())
+}
+
+func rm(v *volume, args []string) {
+	if v.fat == nil {
+		ck(errors.New("exfat volumes are read-only"))
+	}
+
+	flags := flag.NewFlagSet("rm", flag.ExitOnError)
+	recursive := flags.Bool("r", false, "remove directories and their contents")
+	flags.Parse(args)
+
+	for _, name := range flags.Args() {
+		name = "/" + fsPath(name)
+		if *recursive {
+			ck(v.fat.RemoveAll(name))
+		} else {
+			ck(v.fat.Remove(name))
+		}
+	}
+}
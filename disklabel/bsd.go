@@ -0,0 +1,93 @@
+package disklabel
+
+import (
+	"io"
+	"strings"
+
+	"github.com/qeedquan/disktools/endian"
+)
+
+const (
+	BSDMagic = 0x82564557
+
+	bsdLabelSector = 1
+	bsdRawPart     = 2
+	bsdMaxParts    = 22
+	bsdPartOffset  = 148
+	bsdPartSize    = 16
+)
+
+var BSDTypes = []string{
+	0:  "unused",
+	1:  "swap",
+	2:  "Version 6",
+	3:  "Version 7",
+	4:  "System V",
+	5:  "4.1BSD",
+	6:  "Eighth Edition",
+	7:  "4.2BSD",
+	8:  "MSDOS",
+	9:  "4.4LFS",
+	10: "unknown",
+	11: "HPFS",
+	12: "ISO9660",
+	13: "boot",
+	14: "vinum",
+	15: "raid",
+}
+
+// ReadBSD reads the disklabel in the second sector of the MBR slice of type
+// typ starting at LBA start. OpenBSD and NetBSD store absolute offsets,
+// FreeBSD stores them relative to the slice except for old labels whose
+// raw partition starts with the slice instead of at 0.
+func ReadBSD(r io.ReaderAt, start uint64, typ uint8) (*Label, error) {
+	var b [512]byte
+	_, err := r.ReadAt(b[:], int64(start+bsdLabelSector)*512)
+	if err != nil {
+		return nil, err
+	}
+	if endian.Read32le(b[0:]) != BSDMagic || endian.Read32le(b[132:]) != BSDMagic {
+		return nil, ErrMagic
+	}
+
+	n := int(endian.Read16le(b[138:]))
+	if n > bsdMaxParts {
+		n = bsdMaxParts
+	}
+	l := &Label{
+		Kind:   BSD,
+		Name:   strings.TrimSpace(cstr(b[24:40])),
+		Sectsz: int(endian.Read32le(b[40:])),
+	}
+
+	var sum uint16
+	for i := 0; i < bsdPartOffset+n*bsdPartSize; i += 2 {
+		sum ^= endian.Read16le(b[i:])
+	}
+	l.ChecksumOK = sum == 0
+
+	base := uint64(0)
+	if typ == 0xa5 {
+		base = start
+		raw := b[bsdPartOffset+bsdRawPart*bsdPartSize:]
+		if n > bsdRawPart && endian.Read32le(raw[4:]) != 0 {
+			base = 0
+		}
+	}
+
+	for i := 0; i < n; i++ {
+		p := b[bsdPartOffset+i*bsdPartSize:]
+		size := endian.Read32le(p[0:])
+		if size == 0 {
+			continue
+		}
+		l.Slices = append(l.Slices, Slice{
+			Index: i,
+			Tag:   uint16(p[12]),
+			First: base + uint64(endian.Read32le(p[4:])),
+			Size:  uint64(size),
+		})
+	}
+
+	return l, nil
+}
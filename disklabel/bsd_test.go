@@ -0,0 +1,70 @@
+package disklabel
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/qeedquan/disktools/endian"
+)
+
+// bsdLabel builds a disk with a label in the slice at start, parts holds
+// the offset and size of partitions a, b, c...
+func bsdLabel(start uint64, parts [][2]uint32) []byte {
+	img := make([]byte, (start+16)*512)
+	b := img[(start+bsdLabelSector)*512:]
+	endian.Put32le(b[0:], BSDMagic)
+	endian.Put32le(b[132:], BSDMagic)
+	copy(b[8:], "SCSI")
+	copy(b[24:], "pack0")
+	endian.Put32le(b[40:], 512)
+	endian.Put16le(b[138:], uint16(len(parts)))
+	for i, p := range parts {
+		e := b[bsdPartOffset+i*bsdPartSize:]
+		endian.Put32le(e[0:], p[1])
+		endian.Put32le(e[4:], p[0])
+		e[12] = 7
+	}
+
+	var sum uint16
+	for i := 0; i < bsdPartOffset+len(parts)*bsdPartSize; i += 2 {
+		sum ^= endian.Read16le(b[i:])
+	}
+	endian.Put16le(b[136:], sum)
+	return img
+}
+
+func TestReadBSD(t *testing.T) {
+	const start = 64
+	tests := []struct {
+		name  string
+		typ   uint8
+		parts [][2]uint32
+		want  []uint64
+	}{
+		// FreeBSD: offsets relative to the slice, c at 0
+		{"freebsd", 0xa5, [][2]uint32{{16, 100}, {116, 100}, {0, 1000}}, []uint64{start + 16, start + 116, start}},
+		// old FreeBSD: absolute offsets, c at the slice start
+		{"old freebsd", 0xa5, [][2]uint32{{start + 16, 100}, {start + 116, 100}, {start, 1000}}, []uint64{start + 16, start + 116, start}},
+		// OpenBSD: absolute offsets, c covers the whole disk from 0
+		{"openbsd", 0xa6, [][2]uint32{{start + 16, 100}, {start + 116, 100}, {0, 2000}}, []uint64{start + 16, start + 116, 0}},
+		// NetBSD: absolute offsets, c covers the slice and d the disk
+		{"netbsd", 0xa9, [][2]uint32{{start + 16, 100}, {start + 116, 100}, {start, 1000}, {0, 2000}}, []uint64{start + 16, start + 116, start, 0}},
+	}
+	for _, tt := range tests {
+		l, err := ReadBSD(bytes.NewReader(bsdLabel(start, tt.parts)), start, tt.typ)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if l.Name != "pack0" || !l.ChecksumOK {
+			t.Errorf("%s: name %q checksum %v", tt.name, l.Name, l.ChecksumOK)
+		}
+		if len(l.Slices) != len(tt.want) {
+			t.Fatalf("%s: got %d slices, want %d", tt.name, len(l.Slices), len(tt.want))
+		}
+		for i, s := range l.Slices {
+			if s.First != tt.want[i] {
+				t.Errorf("%s: slice %s starts at %d, want %d", tt.name, l.SliceName(&s), s.First, tt.want[i])
+			}
+		}
+	}
+}
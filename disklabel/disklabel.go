@@ -0,0 +1,121 @@
+package disklabel
+
+import (
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/qeedquan/disktools/mbr"
+)
+
+type Kind int
+
+const (
+	BSD Kind = iota
+	SunSMI
+	SolarisX86
+)
+
+// the First field of a slice is an absolute LBA on the disk
+// the label was read from, regardless of how the label stores it
+type Slice struct {
+	Index int
+	Tag   uint16
+	Flag  uint16
+	First uint64
+	Size  uint64
+}
+
+// labels without a checksum always have ChecksumOK set
+type Label struct {
+	Kind       Kind
+	Name       string
+	Sectsz     int
+	ChecksumOK bool
+	Slices     []Slice
+}
+
+var (
+	ErrMagic = errors.New("disklabel: invalid magic")
+)
+
+func (k Kind) String() string {
+	switch k {
+	case BSD:
+		return "BSD disklabel"
+	case SunSMI:
+		return "Sun SMI label"
+	case SolarisX86:
+		return "Solaris x86 VTOC"
+	}
+	return fmt.Sprintf("Kind(%d)", int(k))
+}
+
+func (s *Slice) Last() uint64 {
+	if s.Size == 0 {
+		return s.First
+	}
+	return s.First + s.Size - 1
+}
+
+// BSD slices are named by letter, Sun slices by number
+func (l *Label) SliceName(s *Slice) string {
+	if l.Kind == BSD {
+		return string(rune('a' + s.Index))
+	}
+	return fmt.Sprint(s.Index)
+}
+
+func (l *Label) TagName(s *Slice) string {
+	var names []string
+	if l.Kind == BSD {
+		names = BSDTypes
+	} else {
+		names = SunTags
+	}
+	if int(s.Tag) < len(names) && names[s.Tag] != "" {
+		return names[s.Tag]
+	}
+	return "unknown"
+}
+
+// Open decodes the label nested inside an MBR partition
+// based on the partition type.
+func Open(r io.ReaderAt, p *mbr.Part) (*Label, error) {
+	start := uint64(p.FirstLBA)
+	switch p.Type {
+	case 0xa5, 0xa6, 0xa9:
+		return ReadBSD(r, start, p.Type)
+	case 0xbf, 0x82:
+		return ReadSolarisX86(r, start)
+	}
+	return nil, fmt.Errorf("disklabel: partition type %#x has no nested label", p.Type)
+}
+
+// OpenMBR decodes every nested label it can find in the record
+// and returns them keyed by partition number.
+func OpenMBR(r io.ReaderAt, rec *mbr.Record) map[int]*Label {
+	m := make(map[int]*Label)
+	for i := range rec.Part {
+		l, err := Open(r, &rec.Part[i])
+		if err == nil {
+			m[i+1] = l
+		}
+	}
+	for i := range rec.Logical {
+		l, err := Open(r, &rec.Logical[i])
+		if err == nil {
+			m[i+5] = l
+		}
+	}
+	return m
+}
+
+func cstr(b []byte) string {
+	for i := range b {
+		if b[i] == 0 {
+			return string(b[:i])
+		}
+	}
+	return string(b)
+}
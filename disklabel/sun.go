@@ -0,0 +1,127 @@
+package disklabel
+
+import (
+	"io"
+	"strings"
+
+	"github.com/qeedquan/disktools/endian"
+)
+
+const (
+	SunMagic  = 0xdabe
+	VTOCMagic = 0x600ddeee
+
+	sunNumParts   = 8
+	x86NumSlices  = 16
+	x86VTOCSector = 1
+)
+
+var SunTags = []string{
+	0x0: "unassigned",
+	0x1: "boot",
+	0x2: "root",
+	0x3: "swap",
+	0x4: "usr",
+	0x5: "backup",
+	0x6: "stand",
+	0x7: "var",
+	0x8: "home",
+	0x9: "alternates",
+	0xa: "cache",
+	0xb: "reserved",
+	0xc: "system",
+}
+
+// ReadSun reads the big endian SMI label used by SPARC systems
+// from the first sector of the disk starting at LBA start.
+// Slices are stored as a starting cylinder which is converted
+// using the geometry in the label.
+func ReadSun(r io.ReaderAt, start uint64) (*Label, error) {
+	var b [512]byte
+	_, err := r.ReadAt(b[:], int64(start)*512)
+	if err != nil {
+		return nil, err
+	}
+	if endian.Read16be(b[508:]) != SunMagic {
+		return nil, ErrMagic
+	}
+
+	var sum uint16
+	for i := 0; i < len(b); i += 2 {
+		sum ^= endian.Read16be(b[i:])
+	}
+
+	l := &Label{
+		Kind:       SunSMI,
+		Name:       strings.TrimSpace(cstr(b[:128])),
+		Sectsz:     512,
+		ChecksumOK: sum == 0,
+	}
+
+	ntrks := uint64(endian.Read16be(b[436:]))
+	nsect := uint64(endian.Read16be(b[438:]))
+	vtoc := endian.Read32be(b[188:]) == VTOCMagic
+	for i := 0; i < sunNumParts; i++ {
+		p := b[444+i*8:]
+		size := endian.Read32be(p[4:])
+		if size == 0 {
+			continue
+		}
+		s := Slice{
+			Index: i,
+			First: start + uint64(endian.Read32be(p[0:]))*ntrks*nsect,
+			Size:  uint64(size),
+		}
+		if vtoc {
+			s.Tag = endian.Read16be(b[142+i*4:])
+			s.Flag = endian.Read16be(b[144+i*4:])
+		}
+		l.Slices = append(l.Slices, s)
+	}
+
+	return l, nil
+}
+
+// ReadSolarisX86 reads the little endian VTOC stored in the second
+// sector of a Solaris fdisk partition starting at LBA start.
+func ReadSolarisX86(r io.ReaderAt, start uint64) (*Label, error) {
+	var b [512]byte
+	_, err := r.ReadAt(b[:], int64(start+x86VTOCSector)*512)
+	if err != nil {
+		return nil, err
+	}
+	if endian.Read32le(b[12:]) != VTOCMagic {
+		return nil, ErrMagic
+	}
+
+	l := &Label{
+		Kind:       SolarisX86,
+		Name:       strings.TrimSpace(cstr(b[20:28])),
+		Sectsz:     int(endian.Read16le(b[28:])),
+		ChecksumOK: true,
+	}
+	if l.Sectsz == 0 {
+		l.Sectsz = 512
+	}
+
+	n := int(endian.Read16le(b[30:]))
+	if n > x86NumSlices {
+		n = x86NumSlices
+	}
+	for i := 0; i < n; i++ {
+		p := b[72+i*12:]
+		size := endian.Read32le(p[8:])
+		if size == 0 {
+			continue
+		}
+		l.Slices = append(l.Slices, Slice{
+			Index: i,
+			Tag:   endian.Read16le(p[0:]),
+			Flag:  endian.Read16le(p[2:]),
+			First: start + uint64(endian.Read32le(p[4:])),
+			Size:  uint64(size),
+		})
+	}
+
+	return l, nil
+}
@@ -1,6 +1,8 @@
 package efi
 
-type GUID [16]uint8
+import "github.com/qeedquan/disktools/guid"
+
+type GUID = guid.GUID
 type Handle interface{}
 type Status int
 type Attributes2 uint32
@@ -0,0 +1,121 @@
+package fat
+
+import (
+	"os"
+	"time"
+)
+
+// Attr holds the attribute bits and timestamps of an entry, it is what
+// Sys returns for a File or ExFile. Dates and times use the DOS encoding,
+// the tenth fields count 10ms units from 0 to 199 on top of the 2 second
+// resolution of the time. FAT only has the creation tenth and an access
+// date, the modification tenth, access time and UTC offsets come from exFAT.
+type Attr struct {
+	Bits       uint8
+	Cdate      uint16
+	Ctime      uint16
+	Ctimetenth uint8
+	Mdate      uint16
+	Mtime      uint16
+	Mtimetenth uint8
+	Adate      uint16
+	Atime      uint16
+
+	// UTC offsets in 15 minute units in the low 7 bits, bit 7 marks
+	// them valid, without one the time is in the location of the filesystem
+	Cutc uint8
+	Mutc uint8
+	Autc uint8
+
+	Loc *time.Location
+}
+
+func (a *Attr) ReadOnly() bool    { return a.Bits&RDONLY != 0 }
+func (a *Attr) Hidden() bool      { return a.Bits&HIDDEN != 0 }
+func (a *Attr) System() bool      { return a.Bits&SYSTEM != 0 }
+func (a *Attr) VolumeLabel() bool { return a.Bits&VOLUME_LABEL != 0 && a.Bits&0xf != 0xf }
+func (a *Attr) IsDir() bool       { return a.Bits&DIRECTORY != 0 && a.Bits&0xf != 0xf }
+func (a *Attr) Archive() bool     { return a.Bits&ARCHIVE != 0 }
+func (a *Attr) Device() bool      { return a.Bits&DEVICE != 0 }
+
+func (a *Attr) Created() time.Time {
+	return a.time(a.Cdate, a.Ctime, a.Ctimetenth, a.Cutc)
+}
+
+func (a *Attr) Modified() time.Time {
+	return a.time(a.Mdate, a.Mtime, a.Mtimetenth, a.Mutc)
+}
+
+func (a *Attr) Accessed() time.Time {
+	return a.time(a.Adate, a.Atime, 0, a.Autc)
+}
+
+func (a *Attr) SetCreated(t time.Time) {
+	a.Cdate, a.Ctime, a.Ctimetenth, a.Cutc = a.encode(t)
+}
+
+func (a *Attr) SetModified(t time.Time) {
+	a.Mdate, a.Mtime, a.Mtimetenth, a.Mutc = a.encode(t)
+}
+
+func (a *Attr) SetAccessed(t time.Time) {
+	a.Adate, a.Atime, _, a.Autc = a.encode(t)
+}
+
+func (a *Attr) Mode() os.FileMode {
+	m := os.FileMode(0777)
+	if a.IsDir() {
+		m |= os.ModeDir
+	}
+	if a.Device() {
+		m |= os.ModeDevice
+	}
+	if a.ReadOnly() {
+		m &^= 0333
+	}
+	return m
+}
+
+func (a *Attr) location(utc uint8) *time.Location {
+	if utc&0x80 != 0 {
+		return time.FixedZone("", int(int8(utc<<1)>>1)*15*60)
+	}
+	if a.Loc != nil {
+		return a.Loc
+	}
+	return time.Local
+}
+
+func (a *Attr) time(date, tm uint16, tenth, utc uint8) time.Time {
+	if date == 0 {
+		return time.Time{}
+	}
+
+	year := 1980 + int(date>>9)
+	month := time.Month(date >> 5 & 0xf)
+	day := int(date & 0x1f)
+	hour := int(tm >> 11)
+	min := int(tm >> 5 & 0x3f)
+	sec := int(tm&0x1f)*2 + int(tenth)/100
+	nsec := int(tenth) % 100 * 10 * int(time.Millisecond)
+	return time.Date(year, month, day, hour, min, sec, nsec, a.location(utc))
+}
+
+// encode keeps the UTC offset of t only if the attributes already carry
+// one, FAT has nowhere to store it
+func (a *Attr) encode(t time.Time) (date, tm uint16, tenth, utc uint8) {
+	if (a.Cutc|a.Mutc|a.Autc)&0x80 != 0 {
+		_, off := t.Zone()
+		utc = 0x80 | uint8(off/(15*60))&0x7f
+	} else {
+		t = t.In(a.location(0))
+	}
+	date, tm = dosTime(t)
+
+	// dosTime clamps to the years a date can hold, the clamped time
+	// has no tenths
+	if y := t.Year(); y >= 1980 && y <= 2107 {
+		tenth = uint8(t.Second()%2*100 + t.Nanosecond()/int(10*time.Millisecond))
+	}
+	return
+}
@@ -0,0 +1,47 @@
+package fat
+
+import (
+	"testing"
+	"time"
+)
+
+func TestAttrTimes(t *testing.T) {
+	for _, tt := range []struct {
+		in, want time.Time
+		tenth    uint8
+	}{
+		{
+			time.Date(2020, 5, 6, 7, 8, 9, 573e6, time.UTC),
+			time.Date(2020, 5, 6, 7, 8, 9, 570e6, time.UTC),
+			157,
+		},
+		{
+			time.Date(1980, 1, 1, 0, 0, 0, 0, time.UTC),
+			time.Date(1980, 1, 1, 0, 0, 0, 0, time.UTC),
+			0,
+		},
+		{
+			time.Date(1979, 12, 31, 23, 59, 59, 990e6, time.UTC),
+			time.Date(1980, 1, 1, 0, 0, 0, 0, time.UTC),
+			0,
+		},
+		{
+			time.Date(2200, 6, 1, 12, 0, 1, 500e6, time.UTC),
+			time.Date(2107, 12, 31, 23, 59, 58, 0, time.UTC),
+			0,
+		},
+	} {
+		a := Attr{Loc: time.UTC}
+		a.SetModified(tt.in)
+		a.SetCreated(tt.in)
+		if a.Mtimetenth != tt.tenth || a.Ctimetenth != tt.tenth {
+			t.Errorf("%v: tenths %d %d, want %d", tt.in, a.Mtimetenth, a.Ctimetenth, tt.tenth)
+		}
+		if got := a.Modified(); !got.Equal(tt.want) {
+			t.Errorf("%v: modified %v, want %v", tt.in, got, tt.want)
+		}
+		if got := a.Created(); !got.Equal(tt.want) {
+			t.Errorf("%v: created %v, want %v", tt.in, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,376 @@
+package fat
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	stdpath "path"
+	"time"
+)
+
+// ProblemKind is the sort of damage a Problem describes
+type ProblemKind int
+
+const (
+	FATMismatch ProblemKind = iota
+	CrossLinked
+	BadChain
+	ChainLoop
+	LostChain
+	SizeMismatch
+	BadLFNChecksum
+	BadDate
+)
+
+// Problem is one inconsistency Check found, Cluster is 0 when it isn't
+// about a particular cluster
+type Problem struct {
+	Kind    ProblemKind
+	Path    string
+	Cluster int64
+	Desc    string
+}
+
+type CheckOptions struct {
+	// Repair links lost chains into files under /FOUND.000
+	Repair bool
+}
+
+type checker struct {
+	fs    *FileSystem
+	fat   []int64
+	owner map[int64]string
+	found []Problem
+}
+
+func (k ProblemKind) String() string {
+	switch k {
+	case FATMismatch:
+		return "FAT mismatch"
+	case CrossLinked:
+		return "cross-linked"
+	case BadChain:
+		return "bad chain"
+	case ChainLoop:
+		return "chain loop"
+	case LostChain:
+		return "lost chain"
+	case SizeMismatch:
+		return "size mismatch"
+	case BadLFNChecksum:
+		return "bad LFN checksum"
+	case BadDate:
+		return "bad date"
+	}
+	return fmt.Sprintf("ProblemKind(%d)", int(k))
+}
+
+func (p Problem) String() string {
+	if p.Path == "" {
+		return fmt.Sprintf("%v: %s", p.Kind, p.Desc)
+	}
+	return fmt.Sprintf("%v: %s: %s", p.Kind, p.Path, p.Desc)
+}
+
+// Check compares the FAT copies and walks every directory the way
+// fsck.fat does, following each chain to see that it ends where the
+// entry's size says and that no cluster belongs to two files. An error
+// means the volume couldn't be read, not that it is damaged.
+func Check(fs *FileSystem, o *CheckOptions) ([]Problem, error) {
+	if o == nil {
+		o = &CheckOptions{}
+	}
+
+	c := &checker{
+		fs:    fs,
+		owner: make(map[int64]string),
+	}
+
+	var err error
+	c.fat, err = fs.loadFAT(0)
+	if err != nil {
+		return nil, err
+	}
+	for i := int64(1); i < fs.nfats; i++ {
+		other, err := fs.loadFAT(i)
+		if err != nil {
+			return nil, err
+		}
+		for n := int64(2); n < int64(len(c.fat)); n++ {
+			if c.fat[n] != other[n] {
+				c.add(FATMismatch, "", n, "FAT 0 has %#x, FAT %d has %#x", c.fat[n], i, other[n])
+			}
+		}
+	}
+
+	root := fs.root()
+	if fs.fatbits == 32 {
+		c.chain("/", fs.rootstart)
+	}
+	err = c.walk(root, "/")
+	if err != nil {
+		return c.found, err
+	}
+
+	lost := c.lost()
+	if o.Repair && len(lost) > 0 {
+		err = c.reclaim(lost)
+	}
+	return c.found, err
+}
+
+func (c *checker) add(k ProblemKind, path string, cluster int64, format string, args ...interface{}) {
+	c.found = append(c.found, Problem{
+		Kind:    k,
+		Path:    path,
+		Cluster: cluster,
+		Desc:    fmt.Sprintf(format, args...),
+	})
+}
+
+func (c *checker) walk(dir *File, path string) error {
+	for pos := int64(0); ; {
+		e, next, err := dir.next(pos)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		pos = next
+
+		if e.dot() || e.dir.Attr&VOLUME_LABEL != 0 && e.dir.Attr&DIRECTORY == 0 {
+			continue
+		}
+
+		name := stdpath.Join(path, e.name)
+		if e.badsum {
+			c.add(BadLFNChecksum, name, 0, "long name entries do not match short name %q", e.short)
+		}
+		c.dates(name, &e.dir)
+
+		start := int64(e.dir.Cluster)
+		if c.fs.fatbits == 32 {
+			start |= int64(e.dir.Cluster32) << 16
+		}
+		n, ok := c.chain(name, start)
+
+		if !ok {
+			continue
+		}
+		if e.dir.Attr&DIRECTORY != 0 {
+			err = c.walk(dir.child(e), name)
+			if err != nil {
+				return err
+			}
+			continue
+		}
+
+		cb := c.fs.clusterBytes()
+		if want := (int64(e.dir.Length) + cb - 1) / cb; want != n {
+			c.add(SizeMismatch, name, start, "size %d needs %d clusters, chain has %d", e.dir.Length, want, n)
+		}
+	}
+}
+
+// chain claims the clusters of the chain starting at start for path,
+// returning its length and whether it was free of conflicts
+func (c *checker) chain(path string, start int64) (int64, bool) {
+	var n int64
+	ok := true
+	mine := make(map[int64]bool)
+	for cl := start; cl != 0; n++ {
+		if cl < 2 || cl >= int64(len(c.fat)) {
+			c.add(BadChain, path, cl, "cluster %d is out of range", cl)
+			return n, false
+		}
+		if mine[cl] {
+			c.add(ChainLoop, path, cl, "chain loops back to cluster %d", cl)
+			return n, false
+		}
+		if p, seen := c.owner[cl]; seen {
+			c.add(CrossLinked, path, cl, "cluster %d is also used by %s", cl, p)
+			return n, false
+		}
+		c.owner[cl] = path
+		mine[cl] = true
+
+		v := c.fat[cl]
+		switch {
+		case c.fs.isEOC(v):
+			return n + 1, ok
+		case v == 0:
+			c.add(BadChain, path, cl, "cluster %d points to a free cluster", cl)
+			return n + 1, false
+		case v == c.fs.badCluster():
+			c.add(BadChain, path, cl, "cluster %d points to a bad cluster", cl)
+			return n + 1, false
+		}
+		cl = v
+	}
+	return n, ok
+}
+
+func (c *checker) dates(path string, d *Dir) {
+	check := func(what string, date, tm uint16, hastime bool) {
+		if date == 0 && tm == 0 {
+			return
+		}
+		year := 1980 + int(date>>9)
+		month := time.Month(date >> 5 & 0xf)
+		day := int(date & 0x1f)
+		if month < 1 || month > 12 || day < 1 || day > daysIn(year, month) {
+			c.add(BadDate, path, 0, "invalid %s date %#04x", what, date)
+		}
+		if hastime && (tm>>11 > 23 || tm>>5&0x3f > 59 || tm&0x1f > 29) {
+			c.add(BadDate, path, 0, "invalid %s time %#04x", what, tm)
+		}
+	}
+	check("modification", d.Date, d.Time, true)
+	check("creation", d.Cdate, d.Ctime, true)
+	check("access", d.Adate, 0, false)
+}
+
+func daysIn(year int, month time.Month) int {
+	return time.Date(year, month+1, 0, 0, 0, 0, 0, time.UTC).Day()
+}
+
+// lost returns the start of every allocated chain not reachable from the
+// directory tree, the chains are claimed in the process
+func (c *checker) lost() []int64 {
+	used := make(map[int64]bool)
+	for cl := int64(2); cl < int64(len(c.fat)); cl++ {
+		if _, seen := c.owner[cl]; !seen && c.fat[cl] != 0 && c.fat[cl] != c.fs.badCluster() {
+			used[cl] = true
+		}
+	}
+
+	pointed := make(map[int64]bool)
+	for cl := range used {
+		if used[c.fat[cl]] {
+			pointed[c.fat[cl]] = true
+		}
+	}
+
+	var heads []int64
+	for cl := int64(2); cl < int64(len(c.fat)); cl++ {
+		if !used[cl] || pointed[cl] && !c.cycle(cl, used) {
+			continue
+		}
+		if _, seen := c.owner[cl]; seen {
+			continue
+		}
+
+		n := int64(0)
+		for v := cl; used[v]; v = c.fat[v] {
+			if _, seen := c.owner[v]; seen {
+				break
+			}
+			c.owner[v] = ""
+			n++
+		}
+		c.add(LostChain, "", cl, "%d clusters starting at %d are not referenced", n, cl)
+		heads = append(heads, cl)
+	}
+	return heads
+}
+
+// cycle reports whether the lost cluster cl is part of a loop,
+// those have no head so any member starts the chain
+func (c *checker) cycle(cl int64, used map[int64]bool) bool {
+	seen := make(map[int64]bool)
+	for v := cl; used[v]; v = c.fat[v] {
+		if seen[v] {
+			return v == cl
+		}
+		seen[v] = true
+	}
+	return false
+}
+
+// reclaim links each lost chain into a FILEnnnn.CHK under /FOUND.000,
+// each chain is cut so it ends in an end of chain marker
+func (c *checker) reclaim(heads []int64) error {
+	fs := c.fs
+	dir, err := fs.walk("/FOUND.000")
+	if err == os.ErrNotExist {
+		dir, err = fs.create(fs.root(), "FOUND.000", DIRECTORY)
+	}
+	if err != nil {
+		return err
+	}
+	if !dir.IsDir() {
+		return &os.PathError{Op: "reclaim", Path: "/FOUND.000", Err: ErrNotDir}
+	}
+
+	num := 0
+	for _, head := range heads {
+		var chain []int64
+		seen := make(map[int64]bool)
+		for v := head; v >= 2 && v < int64(len(c.fat)) && !seen[v] && c.owner[v] == ""; v = c.fat[v] {
+			chain = append(chain, v)
+			seen[v] = true
+			if fs.isEOC(c.fat[v]) {
+				break
+			}
+		}
+		last := chain[len(chain)-1]
+		if !fs.isEOC(c.fat[last]) {
+			err = fs.setFAT(last, fs.eoc())
+			if err != nil {
+				return err
+			}
+		}
+
+		var f *File
+		for ; ; num++ {
+			name := fmt.Sprintf("FILE%04d.CHK", num)
+			f, err = fs.create(dir, name, ARCHIVE)
+			if err != os.ErrExist {
+				break
+			}
+		}
+		num++
+		if err != nil {
+			return err
+		}
+
+		f.setStart(head)
+		f.dir.Length = uint32(int64(len(chain)) * fs.clusterBytes())
+		err = f.sync()
+		if err != nil {
+			return err
+		}
+		for _, v := range chain {
+			c.owner[v] = f.name
+		}
+	}
+	return nil
+}
+
+// loadFAT decodes FAT copy n for every cluster of the volume
+func (fs *FileSystem) loadFAT(n int64) ([]int64, error) {
+	buf := make([]byte, fs.fatsz*fs.sectsz)
+	_, err := fs.rw.ReadAt(buf, fs.fatAddr(n, 0))
+	if err != nil {
+		return nil, err
+	}
+
+	fat := make([]int64, fs.maxCluster()+1)
+	for c := range fat {
+		switch fs.fatbits {
+		case 12:
+			v := int64(binary.LittleEndian.Uint16(buf[c+c/2:]))
+			if c&1 != 0 {
+				v >>= 4
+			}
+			fat[c] = v & 0xfff
+		case 16:
+			fat[c] = int64(binary.LittleEndian.Uint16(buf[c*2:]))
+		case 32:
+			fat[c] = int64(binary.LittleEndian.Uint32(buf[c*4:])) & 0xfffffff
+		}
+	}
+	return fat, nil
+}
@@ -0,0 +1,154 @@
+package fat
+
+import (
+	"encoding/binary"
+	"io"
+	"reflect"
+	"testing"
+)
+
+func problemKinds(ps []Problem) []ProblemKind {
+	var k []ProblemKind
+	for _, p := range ps {
+		k = append(k, p.Kind)
+	}
+	return k
+}
+
+func TestCheck(t *testing.T) {
+	// in the FAT16 image README.TXT is cluster 3, the long file 10-11 and
+	// SUB 5 with INNER.TXT at 6, the root holds the label, README.TXT, two
+	// long name entries and LONGFI~1.TXT in that order
+	tests := []struct {
+		name    string
+		corrupt func(d memDisk, fs *FileSystem)
+		want    []ProblemKind
+	}{
+		{"clean", func(memDisk, *FileSystem) {}, nil},
+		{"FAT copies differ", func(d memDisk, fs *FileSystem) {
+			binary.LittleEndian.PutUint16(d[fs.fatAddr(1, 3):], 0xfff8)
+		}, []ProblemKind{FATMismatch}},
+		{"cross-linked", func(d memDisk, fs *FileSystem) {
+			binary.LittleEndian.PutUint16(d[fs.rootaddr*fs.sectsz+32+26:], 10)
+		}, []ProblemKind{SizeMismatch, CrossLinked, LostChain}},
+		{"free cluster in chain", func(d memDisk, fs *FileSystem) {
+			fs.setFAT(10, 40)
+		}, []ProblemKind{BadChain, LostChain}},
+		{"bad cluster in chain", func(d memDisk, fs *FileSystem) {
+			fs.setFAT(10, 30)
+		}, []ProblemKind{BadChain, LostChain}},
+		{"out of range", func(d memDisk, fs *FileSystem) {
+			fs.setFAT(10, 0xfff0)
+		}, []ProblemKind{BadChain, LostChain}},
+		{"loop", func(d memDisk, fs *FileSystem) {
+			fs.setFAT(11, 10)
+		}, []ProblemKind{ChainLoop}},
+		{"self loop", func(d memDisk, fs *FileSystem) {
+			fs.setFAT(3, 3)
+		}, []ProblemKind{ChainLoop}},
+		{"lost", func(d memDisk, fs *FileSystem) {
+			fs.setFAT(50, 51)
+			fs.setFAT(51, fs.eoc())
+		}, []ProblemKind{LostChain}},
+		{"size", func(d memDisk, fs *FileSystem) {
+			binary.LittleEndian.PutUint32(d[fs.rootaddr*fs.sectsz+32+28:], 5000)
+		}, []ProblemKind{SizeMismatch}},
+		{"LFN checksum", func(d memDisk, fs *FileSystem) {
+			d[fs.rootaddr*fs.sectsz+2*32+13]++
+		}, []ProblemKind{BadLFNChecksum}},
+	}
+	for _, tt := range tests {
+		d, fs := openImage(t, 16)
+		tt.corrupt(d, fs)
+		problems, err := Check(fs, nil)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if got := problemKinds(problems); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: got %v, want %v", tt.name, problems, tt.want)
+		}
+	}
+}
+
+func TestCheckRepair(t *testing.T) {
+	d, fs := openImage(t, 16)
+
+	// a chain and a loop nothing refers to
+	fs.setFAT(50, 51)
+	fs.setFAT(51, fs.eoc())
+	fs.setFAT(60, 61)
+	fs.setFAT(61, 60)
+	copy(d[fs.clusterAddr(50):], "lost data")
+
+	problems, err := Check(fs, &CheckOptions{Repair: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := problemKinds(problems); !reflect.DeepEqual(got, []ProblemKind{LostChain, LostChain}) {
+		t.Fatalf("got %v", problems)
+	}
+
+	fs, err = NewFileSystem(d, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	problems, err = Check(fs, nil)
+	if err != nil || len(problems) != 0 {
+		t.Errorf("after repair: %v %v", problems, err)
+	}
+
+	cb := fs.clusterBytes()
+	for name, size := range map[string]int64{
+		"/FOUND.000/FILE0000.CHK": 2 * cb,
+		"/FOUND.000/FILE0001.CHK": 2 * cb,
+	} {
+		f, err := fs.Open(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, err := io.ReadAll(f)
+		if err != nil || int64(len(b)) != size {
+			t.Errorf("%s: read %d bytes %v, want %d", name, len(b), err, size)
+		}
+		if name == "/FOUND.000/FILE0000.CHK" && string(b[:9]) != "lost data" {
+			t.Errorf("%s: starts with %q", name, b[:9])
+		}
+	}
+}
+
+func TestCheckDates(t *testing.T) {
+	d, fs := openImage(t, 16)
+	problems, err := Check(fs, nil)
+	if err != nil || len(problems) != 0 {
+		t.Fatalf("clean image: %v %v", problems, err)
+	}
+
+	// README.TXT is the entry after the label
+	addr := fs.rootaddr*fs.sectsz + fatDirsz + 24
+	for _, tt := range []struct {
+		year, month, day int
+		bad              bool
+	}{
+		{2020, 2, 29, false},
+		{2021, 2, 29, true},
+		{2100, 2, 29, true},
+		{2000, 2, 29, false},
+		{2020, 4, 30, false},
+		{2020, 4, 31, true},
+		{2020, 12, 31, false},
+		{2020, 13, 1, true},
+		{2020, 1, 0, true},
+	} {
+		date := uint16(tt.year-1980)<<9 | uint16(tt.month)<<5 | uint16(tt.day)
+		binary.LittleEndian.PutUint16(d[addr:], date)
+
+		problems, err := Check(fs, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		bad := len(problems) == 1 && problems[0].Kind == BadDate && problems[0].Path == "/README.TXT"
+		if bad != tt.bad || (!bad && len(problems) != 0) {
+			t.Errorf("%d-%02d-%02d: %v", tt.year, tt.month, tt.day, problems)
+		}
+	}
+}
@@ -0,0 +1,41 @@
+package fat
+
+// Codepage maps the OEM bytes 0x80-0xff used by short names to runes,
+// the lower half is ASCII
+type Codepage [128]rune
+
+var CP437 = Codepage{
+	'Ç', 'ü', 'é', 'â', 'ä', 'à', 'å', 'ç', 'ê', 'ë', 'è', 'ï', 'î', 'ì', 'Ä', 'Å',
+	'É', 'æ', 'Æ', 'ô', 'ö', 'ò', 'û', 'ù', 'ÿ', 'Ö', 'Ü', '¢', '£', '¥', '₧', 'ƒ',
+	'á', 'í', 'ó', 'ú', 'ñ', 'Ñ', 'ª', 'º', '¿', '⌐', '¬', '½', '¼', '¡', '«', '»',
+	'░', '▒', '▓', '│', '┤', '╡', '╢', '╖', '╕', '╣', '║', '╗', '╝', '╜', '╛', '┐',
+	'└', '┴', '┬', '├', '─', '┼', '╞', '╟', '╚', '╔', '╩', '╦', '╠', '═', '╬', '╧',
+	'╨', '╤', '╥', '╙', '╘', '╒', '╓', '╫', '╪', '┘', '┌', '█', '▄', '▌', '▐', '▀',
+	'α', 'ß', 'Γ', 'π', 'Σ', 'σ', 'µ', 'τ', 'Φ', 'Θ', 'Ω', 'δ', '∞', 'φ', 'ε', '∩',
+	'≡', '±', '≥', '≤', '⌠', '⌡', '÷', '≈', '°', '∙', '·', '√', 'ⁿ', '²', '■', '\u00a0',
+}
+
+func (cp *Codepage) Decode(b []byte) string {
+	r := make([]rune, len(b))
+	for i, c := range b {
+		if c < 0x80 {
+			r[i] = rune(c)
+		} else {
+			r[i] = cp[c-0x80]
+		}
+	}
+	return string(r)
+}
+
+// Encode returns the OEM byte for r, ok is false if the codepage lacks it
+func (cp *Codepage) Encode(r rune) (c byte, ok bool) {
+	if r < 0x80 {
+		return byte(r), true
+	}
+	for i, x := range cp {
+		if x == r {
+			return byte(0x80 + i), true
+		}
+	}
+	return 0, false
+}
@@ -0,0 +1,668 @@
+package fat
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	stdpath "path"
+	"strings"
+	"time"
+	"unicode/utf16"
+
+	"github.com/qeedquan/disktools/iod"
+)
+
+var (
+	ErrExFAT         = errors.New("exfat volume, use NewExFileSystem")
+	ErrNotExFAT      = errors.New("not an exfat volume")
+	ErrBootChecksum  = errors.New("boot region checksum mismatch")
+	ErrUpcaseTable   = errors.New("up-case table checksum mismatch")
+	ErrNoBitmap      = errors.New("allocation bitmap not found")
+	ErrBitmapSize    = errors.New("allocation bitmap size doesn't match the cluster count")
+	ErrExFATGeometry = errors.New("invalid exfat geometry")
+)
+
+type ExPBS struct {
+	Magic      [3]uint8
+	Fsname     [8]uint8
+	_          [53]uint8
+	Partoff    uint64
+	Volsz      uint64
+	Fatoff     uint32
+	Fatsz      uint32
+	Heapoff    uint32
+	Nclusters  uint32
+	Rootstart  uint32
+	Serial     uint32
+	Revision   uint16
+	Flags      uint16
+	Sectshift  uint8
+	Clustshift uint8
+	NumFats    uint8
+	Driveno    uint8
+	Percent    uint8
+	_          [7]uint8
+	Bootcode   [390]uint8
+	Bootsig    uint16
+}
+
+const (
+	exEOD        = 0x00
+	exBitmap     = 0x81
+	exUpcase     = 0x82
+	exLabel      = 0x83
+	exFile       = 0x85
+	exStream     = 0xc0
+	exName       = 0xc1
+	exNoFatChain = 0x02
+)
+
+type ExFileSystem struct {
+	rw  iod.RW
+	opt *FileSystemOptions
+	cwd string
+
+	sectsz    int64
+	clustersz int64
+	fataddr   int64
+	heapaddr  int64
+	nclusters int64
+	volsz     int64
+	rootstart int64
+	serial    uint32
+	revision  uint16
+	flags     uint16
+	label     string
+	bitmap    []byte
+	upcase    []uint16
+
+	rootdir ExFile
+}
+
+type ExFile struct {
+	fs       *ExFileSystem
+	name     string
+	attr     Attr
+	first    int64
+	size     int64
+	valid    int64
+	nofat    bool
+	root     bool
+	clusters []int64
+	off      int64
+	dirpos   int64
+}
+
+func NewExFileSystem(rw iod.RW, opt *FileSystemOptions) (*ExFileSystem, error) {
+	if opt == nil {
+		opt = &FileSystemOptions{}
+	}
+	fs := &ExFileSystem{
+		rw:  rw,
+		cwd: "/",
+		opt: opt,
+	}
+
+	var pbs ExPBS
+	err := binary.Read(io.NewSectionReader(rw, 0, 512), binary.LittleEndian, &pbs)
+	if err != nil {
+		return nil, err
+	}
+	if string(pbs.Fsname[:]) != "EXFAT   " {
+		return nil, ErrNotExFAT
+	}
+	if pbs.Sectshift < 9 || pbs.Sectshift > 12 || pbs.Sectshift+pbs.Clustshift > 25 ||
+		pbs.NumFats < 1 || pbs.NumFats > 2 {
+		return nil, ErrExFATGeometry
+	}
+
+	fs.sectsz = 1 << pbs.Sectshift
+	fs.clustersz = fs.sectsz << pbs.Clustshift
+	fs.fataddr = int64(pbs.Fatoff) * fs.sectsz
+	if pbs.NumFats == 2 && pbs.Flags&1 != 0 {
+		fs.fataddr += int64(pbs.Fatsz) * fs.sectsz
+	}
+	fs.heapaddr = int64(pbs.Heapoff) * fs.sectsz
+	fs.nclusters = int64(pbs.Nclusters)
+	fs.volsz = int64(pbs.Volsz)
+	fs.rootstart = int64(pbs.Rootstart)
+	fs.serial = pbs.Serial
+	fs.revision = pbs.Revision
+	fs.flags = pbs.Flags
+
+	err = fs.checkBoot()
+	if err != nil {
+		return nil, err
+	}
+
+	fs.rootdir = ExFile{
+		fs:    fs,
+		name:  "/",
+		attr:  Attr{Bits: DIRECTORY},
+		first: fs.rootstart,
+		root:  true,
+	}
+	fs.rootdir.calcClusters()
+	fs.rootdir.size = int64(len(fs.rootdir.clusters)) * fs.clustersz
+	fs.rootdir.valid = fs.rootdir.size
+
+	err = fs.readMeta()
+	if err != nil {
+		return nil, err
+	}
+	return fs, nil
+}
+
+// the boot checksum covers the first 11 sectors of the boot region,
+// skipping the volume flags and percent in use, sector 11 repeats it
+func (fs *ExFileSystem) checkBoot() error {
+	buf := make([]byte, 12*fs.sectsz)
+	_, err := fs.rw.ReadAt(buf, 0)
+	if err != nil {
+		return err
+	}
+
+	var sum uint32
+	for i, b := range buf[:11*fs.sectsz] {
+		if i == 106 || i == 107 || i == 112 {
+			continue
+		}
+		sum = (sum&1)<<31 + sum>>1 + uint32(b)
+	}
+	for i := 11 * fs.sectsz; i < 12*fs.sectsz; i += 4 {
+		if binary.LittleEndian.Uint32(buf[i:]) != sum {
+			return ErrBootChecksum
+		}
+	}
+	return nil
+}
+
+// readMeta loads the label, allocation bitmap and up-case table from the
+// critical entries of the root directory
+func (fs *ExFileSystem) readMeta() error {
+	var buf [fatDirsz]byte
+	var upsum uint32
+	var upfirst, uplen int64
+	for pos := int64(0); pos < fs.rootdir.size; pos += fatDirsz {
+		_, err := fs.rootdir.readData(buf[:], pos)
+		if err != nil {
+			return err
+		}
+
+		switch buf[0] {
+		case exEOD:
+			pos = fs.rootdir.size
+		case exBitmap:
+			if buf[1]&1 != 0 && fs.flags&1 == 0 || buf[1]&1 == 0 && fs.flags&1 != 0 {
+				continue
+			}
+			// the length may be padded to the cluster it lives in, but
+			// only the bits for the clusters in the heap are read
+			n := (fs.nclusters + 7) / 8
+			size := binary.LittleEndian.Uint64(buf[24:])
+			if size < uint64(n) || size-uint64(n) >= uint64(fs.clustersz) {
+				return ErrBitmapSize
+			}
+			b := &ExFile{fs: fs, first: int64(binary.LittleEndian.Uint32(buf[20:]))}
+			b.calcClusters()
+			fs.bitmap = make([]byte, n)
+			b.size, b.valid = n, n
+			_, err = b.readData(fs.bitmap, 0)
+		case exUpcase:
+			upsum = binary.LittleEndian.Uint32(buf[4:])
+			upfirst = int64(binary.LittleEndian.Uint32(buf[20:]))
+			uplen = int64(binary.LittleEndian.Uint64(buf[24:]))
+		case exLabel:
+			n := int(buf[1])
+			if n > 11 {
+				n = 11
+			}
+			u := make([]uint16, n)
+			for i := range u {
+				u[i] = binary.LittleEndian.Uint16(buf[2+2*i:])
+			}
+			fs.label = string(utf16.Decode(u))
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	if fs.bitmap == nil {
+		return ErrNoBitmap
+	}
+	if uplen > 0 {
+		return fs.readUpcase(upfirst, uplen, upsum)
+	}
+	return nil
+}
+
+// the up-case table is stored compressed, 0xffff followed by a count
+// maps that many characters to themselves
+func (fs *ExFileSystem) readUpcase(first, size int64, want uint32) error {
+	if size > 1<<18 {
+		return ErrUpcaseTable
+	}
+	f := &ExFile{fs: fs, first: first, size: size, valid: size}
+	f.calcClusters()
+	buf := make([]byte, size)
+	_, err := f.readData(buf, 0)
+	if err != nil {
+		return err
+	}
+
+	var sum uint32
+	for _, b := range buf {
+		sum = (sum&1)<<31 + sum>>1 + uint32(b)
+	}
+	if sum != want {
+		return ErrUpcaseTable
+	}
+
+	fs.upcase = make([]uint16, 0, 0x10000)
+	for i := 0; i+1 < len(buf) && len(fs.upcase) < 0x10000; i += 2 {
+		v := binary.LittleEndian.Uint16(buf[i:])
+		if v == 0xffff && i+3 < len(buf) {
+			i += 2
+			n := int(binary.LittleEndian.Uint16(buf[i:]))
+			for ; n > 0 && len(fs.upcase) < 0x10000; n-- {
+				fs.upcase = append(fs.upcase, uint16(len(fs.upcase)))
+			}
+			continue
+		}
+		fs.upcase = append(fs.upcase, v)
+	}
+	return nil
+}
+
+func (fs *ExFileSystem) getFAT(c int64) (int64, error) {
+	var b [4]byte
+	_, err := fs.rw.ReadAt(b[:], fs.fataddr+c*4)
+	return int64(binary.LittleEndian.Uint32(b[:])), err
+}
+
+// Allocated reports whether cluster c is marked in use in the bitmap
+func (fs *ExFileSystem) Allocated(c int64) bool {
+	c -= 2
+	if c < 0 || c/8 >= int64(len(fs.bitmap)) {
+		return false
+	}
+	return fs.bitmap[c/8]&(1<<uint(c%8)) != 0
+}
+
+func (fs *ExFileSystem) used() int64 {
+	var n int64
+	for c := int64(2); c < fs.nclusters+2; c++ {
+		if fs.Allocated(c) {
+			n++
+		}
+	}
+	return n
+}
+
+func (fs *ExFileSystem) upper(s string) string {
+	u := utf16.Encode([]rune(s))
+	for i, c := range u {
+		if int(c) < len(fs.upcase) {
+			u[i] = fs.upcase[c]
+		}
+	}
+	return string(utf16.Decode(u))
+}
+
+func (fs *ExFileSystem) compareName(a, b string) int {
+	if !fs.opt.Case {
+		if fs.upcase != nil {
+			a, b = fs.upper(a), fs.upper(b)
+		} else {
+			a, b = strings.ToUpper(a), strings.ToUpper(b)
+		}
+	}
+	return strings.Compare(a, b)
+}
+
+func (fs *ExFileSystem) Getwd() (string, error) {
+	return fs.cwd, nil
+}
+
+func (fs *ExFileSystem) Chdir(dir string) error {
+	f, err := fs.Open(dir)
+	if err != nil {
+		return err
+	}
+	if !f.IsDir() {
+		return &os.PathError{Op: "chdir", Path: dir, Err: ErrNotDir}
+	}
+	fs.cwd = fs.abs(dir)
+	return nil
+}
+
+func (fs *ExFileSystem) Stat(name string) (os.FileInfo, error) {
+	return fs.Open(name)
+}
+
+func (fs *ExFileSystem) Lstat(name string) (os.FileInfo, error) {
+	return fs.Open(name)
+}
+
+func (fs *ExFileSystem) abs(name string) string {
+	if stdpath.IsAbs(name) {
+		return stdpath.Clean(name)
+	}
+	return stdpath.Join(fs.cwd, name)
+}
+
+func (fs *ExFileSystem) Open(name string) (*ExFile, error) {
+	return fs.OpenFile(name, os.O_RDONLY, 0)
+}
+
+// OpenFile only supports reading, exFAT volumes are read-only
+func (fs *ExFileSystem) OpenFile(name string, flag int, perm os.FileMode) (*ExFile, error) {
+	name = fs.abs(name)
+	if flag&(os.O_WRONLY|os.O_RDWR|os.O_CREATE|os.O_TRUNC|os.O_APPEND) != 0 {
+		return nil, &os.PathError{Op: "open", Path: name, Err: os.ErrPermission}
+	}
+
+	f, err := fs.walk(name)
+	if err != nil {
+		return nil, &os.PathError{Op: "open", Path: name, Err: err}
+	}
+	return f, nil
+}
+
+func (fs *ExFileSystem) walk(name string) (*ExFile, error) {
+	f := &ExFile{}
+	*f = fs.rootdir
+	name = stdpath.Clean(name)
+	if name == "/" {
+		return f, nil
+	}
+
+	p := splitPath(name)
+	for i := len(p) - 1; i >= 0; i-- {
+		if !f.IsDir() {
+			return nil, ErrNotDir
+		}
+		var next *ExFile
+		for pos := int64(0); next == nil; {
+			c, np, err := f.next(pos)
+			if err == io.EOF {
+				return nil, os.ErrNotExist
+			}
+			if err != nil {
+				return nil, err
+			}
+			pos = np
+			if fs.compareName(c.name, p[i]) == 0 {
+				next = c
+			}
+		}
+		f = next
+	}
+	return f, nil
+}
+
+func (fs *ExFileSystem) String() string {
+	b := new(bytes.Buffer)
+	fmt.Fprintf(b, "Type:           exFAT\n")
+	if fs.label != "" {
+		fmt.Fprintf(b, "Label:          %s\n", fs.label)
+	}
+	fmt.Fprintf(b, "Serial:         %04X-%04X\n", fs.serial>>16, fs.serial&0xffff)
+	fmt.Fprintf(b, "Revision:       %d.%02d\n", fs.revision>>8, fs.revision&0xff)
+	fmt.Fprintf(b, "Sector size:    %d\n", fs.sectsz)
+	fmt.Fprintf(b, "Cluster size:   %d\n", fs.clustersz)
+	fmt.Fprintf(b, "Volume size:    %d\n", fs.volsz)
+	fmt.Fprintf(b, "FAT address:    %d\n", fs.fataddr)
+	fmt.Fprintf(b, "Heap address:   %d\n", fs.heapaddr)
+	fmt.Fprintf(b, "Root cluster:   %d\n", fs.rootstart)
+	fmt.Fprintf(b, "Clusters:       %d\n", fs.nclusters)
+	fmt.Fprintf(b, "Used clusters:  %d", fs.used())
+	return b.String()
+}
+
+func (f *ExFile) Stat() (os.FileInfo, error) { return f, nil }
+
+func (f *ExFile) Name() string       { return f.name }
+func (f *ExFile) IsDir() bool        { return f.attr.Bits&DIRECTORY != 0 }
+func (f *ExFile) Size() int64        { return f.size }
+func (f *ExFile) ModTime() time.Time { return f.attr.Modified() }
+func (f *ExFile) Mode() os.FileMode  { return f.attr.Mode() }
+func (f *ExFile) Sys() interface{}   { return f.Attr() }
+func (f *ExFile) Close() error       { return nil }
+
+func (f *ExFile) Attr() *Attr {
+	a := f.attr
+	return &a
+}
+
+func (f *ExFile) calcClusters() {
+	f.clusters = f.clusters[:0]
+	if f.first < 2 {
+		return
+	}
+
+	if f.nofat {
+		n := (f.size + f.fs.clustersz - 1) / f.fs.clustersz
+		for c := f.first; c < f.first+n && c < f.fs.nclusters+2; c++ {
+			f.clusters = append(f.clusters, c)
+		}
+		return
+	}
+
+	seen := make(map[int64]bool)
+	for c := f.first; c >= 2 && c < f.fs.nclusters+2 && !seen[c]; {
+		f.clusters = append(f.clusters, c)
+		seen[c] = true
+
+		v, err := f.fs.getFAT(c)
+		if err != nil || v >= 0xfffffff7 {
+			break
+		}
+		c = v
+	}
+}
+
+func (f *ExFile) Seek(off int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekStart:
+		if f.IsDir() {
+			f.dirpos = 0
+		}
+	case io.SeekCurrent:
+		off += f.off
+	case io.SeekEnd:
+		off += f.size
+	default:
+		return 0, os.ErrInvalid
+	}
+	if off < 0 {
+		return 0, os.ErrInvalid
+	}
+	f.off = off
+	return off, nil
+}
+
+func (f *ExFile) Read(b []byte) (int, error) {
+	n, err := f.ReadAt(b, f.off)
+	f.off += int64(n)
+	if err == io.EOF && n > 0 {
+		err = nil
+	}
+	return n, err
+}
+
+func (f *ExFile) ReadAt(b []byte, off int64) (int, error) {
+	if f.IsDir() {
+		return 0, &os.PathError{Op: "read", Path: f.name, Err: ErrIsDir}
+	}
+	return f.readData(b, off)
+}
+
+// readData reads the data of the file, bytes past the valid data length
+// read as zero
+func (f *ExFile) readData(b []byte, off int64) (int, error) {
+	cb := f.fs.clustersz
+	n := 0
+	for n < len(b) && off < f.size {
+		m := int64(len(b) - n)
+		if m > cb-off%cb {
+			m = cb - off%cb
+		}
+		if m > f.size-off {
+			m = f.size - off
+		}
+
+		if off >= f.valid {
+			for i := range b[n : n+int(m)] {
+				b[n+i] = 0
+			}
+		} else {
+			if m > f.valid-off {
+				m = f.valid - off
+			}
+			i := off / cb
+			if i >= int64(len(f.clusters)) {
+				return n, fmt.Errorf("encountered bad cluster %d at offset %d", i, off%cb)
+			}
+			addr := f.fs.heapaddr + (f.clusters[i]-2)*cb + off%cb
+			_, err := f.fs.rw.ReadAt(b[n:n+int(m)], addr)
+			if err != nil {
+				return n, err
+			}
+		}
+		n += int(m)
+		off += m
+	}
+
+	if n < len(b) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+func (f *ExFile) Readdir(n int) ([]os.FileInfo, error) {
+	if !f.IsDir() {
+		return nil, &os.PathError{Op: "readdir", Path: f.name, Err: ErrNotDir}
+	}
+
+	var fis []os.FileInfo
+	want := n
+	if n <= 0 {
+		n = -1
+	}
+	for n != 0 {
+		c, pos, err := f.next(f.dirpos)
+		f.dirpos = pos
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return fis, err
+		}
+		fis = append(fis, c)
+		n--
+	}
+
+	if want > 0 && len(fis) == 0 {
+		return nil, io.EOF
+	}
+	return fis, nil
+}
+
+// next returns the file described by the next valid entry set at or
+// after pos, sets failing their checksum are skipped
+func (f *ExFile) next(pos int64) (*ExFile, int64, error) {
+	var buf [fatDirsz]byte
+	for pos < f.size {
+		_, err := f.readData(buf[:], pos)
+		if err != nil {
+			return nil, pos, err
+		}
+		if buf[0] == exEOD {
+			return nil, pos, io.EOF
+		}
+		if buf[0] != exFile {
+			pos += fatDirsz
+			continue
+		}
+
+		nsec := int64(buf[1])
+		set := make([]byte, (nsec+1)*fatDirsz)
+		_, err = f.readData(set, pos)
+		if err != nil && err != io.EOF {
+			return nil, pos, err
+		}
+		pos += int64(len(set))
+		if c := f.decodeSet(set); c != nil {
+			return c, pos, nil
+		}
+	}
+	return nil, pos, io.EOF
+}
+
+func (f *ExFile) decodeSet(set []byte) *ExFile {
+	if len(set) < 3*fatDirsz {
+		return nil
+	}
+
+	var sum uint16
+	for i, b := range set {
+		if i == 2 || i == 3 {
+			continue
+		}
+		sum = (sum&1)<<15 + sum>>1 + uint16(b)
+	}
+	if sum != binary.LittleEndian.Uint16(set[2:]) {
+		return nil
+	}
+
+	s := set[fatDirsz:]
+	if s[0] != exStream {
+		return nil
+	}
+
+	c := &ExFile{
+		fs: f.fs,
+		attr: Attr{
+			Bits:       set[4],
+			Ctime:      binary.LittleEndian.Uint16(set[8:]),
+			Cdate:      binary.LittleEndian.Uint16(set[10:]),
+			Mtime:      binary.LittleEndian.Uint16(set[12:]),
+			Mdate:      binary.LittleEndian.Uint16(set[14:]),
+			Atime:      binary.LittleEndian.Uint16(set[16:]),
+			Adate:      binary.LittleEndian.Uint16(set[18:]),
+			Ctimetenth: set[20],
+			Mtimetenth: set[21],
+			Cutc:       set[22],
+			Mutc:       set[23],
+			Autc:       set[24],
+			Loc:        f.fs.opt.Loc,
+		},
+		nofat: s[1]&exNoFatChain != 0,
+		valid: int64(binary.LittleEndian.Uint64(s[8:])),
+		first: int64(binary.LittleEndian.Uint32(s[20:])),
+		size:  int64(binary.LittleEndian.Uint64(s[24:])),
+	}
+	// a set claiming more data than the volume holds is corrupt,
+	// treat it like a checksum mismatch
+	if c.size < 0 || c.valid < 0 || c.valid > c.size || c.size > f.fs.nclusters*f.fs.clustersz {
+		return nil
+	}
+
+	var name []uint16
+	for i := 2 * fatDirsz; i+fatDirsz <= len(set) && set[i] == exName; i += fatDirsz {
+		for j := 2; j < fatDirsz; j += 2 {
+			name = append(name, binary.LittleEndian.Uint16(set[i+j:]))
+		}
+	}
+	if n := int(s[3]); n < len(name) {
+		name = name[:n]
+	}
+	c.name = string(utf16.Decode(name))
+	c.calcClusters()
+	return c
+}
@@ -0,0 +1,86 @@
+package fat
+
+import (
+	"encoding/binary"
+	iofs "io/fs"
+	"testing"
+)
+
+func TestBitmapSize(t *testing.T) {
+	// the bitmap entry follows the label in the root at cluster 4,
+	// the heap has 4064 clusters of 4K
+	const entry = (256+2*8)*512 + 32
+	for _, tt := range []struct {
+		size uint64
+		err  error
+	}{
+		{508, nil},
+		{4096, nil},
+		{507, ErrBitmapSize},
+		{508 + 4096, ErrBitmapSize},
+		{1 << 40, ErrBitmapSize},
+	} {
+		d := loadImage(t, "exfat.img.gz")
+		binary.LittleEndian.PutUint64(d[entry+24:], tt.size)
+		fs, err := NewExFileSystem(d, nil)
+		if err != tt.err {
+			t.Errorf("%d: got %v, want %v", tt.size, err, tt.err)
+			continue
+		}
+		if err == nil && (len(fs.bitmap) != 508 || !fs.Allocated(10) || fs.Allocated(11)) {
+			t.Errorf("%d: read %d bytes of bitmap", tt.size, len(fs.bitmap))
+		}
+	}
+}
+
+func TestStreamSize(t *testing.T) {
+	// hello.txt is the fourth set in the root, its stream entry has the
+	// valid data length at 8 and the data length at 24
+	const (
+		set    = (256+2*8)*512 + 192
+		stream = set + 32
+	)
+	heap := uint64(4064 * 4096)
+	for _, tt := range []struct {
+		valid, size uint64
+		ok          bool
+	}{
+		{6000, 6000, true},
+		{0, heap, true},
+		{1<<63 + 5, 1<<63 + 5, false},
+		{5, 1<<63 + 5, false},
+		{7000, 6000, false},
+		{6000, heap + 1, false},
+	} {
+		d := loadImage(t, "exfat.img.gz")
+		binary.LittleEndian.PutUint64(d[stream+8:], tt.valid)
+		binary.LittleEndian.PutUint64(d[stream+24:], tt.size)
+		b := d[set : set+(int(d[set+1])+1)*32]
+		var sum uint16
+		for i, c := range b {
+			if i != 2 && i != 3 {
+				sum = (sum&1)<<15 + sum>>1 + uint16(c)
+			}
+		}
+		binary.LittleEndian.PutUint16(b[2:], sum)
+
+		fs, err := NewExFileSystem(d, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = fs.Stat("/hello.txt")
+		if ok := err == nil; ok != tt.ok {
+			t.Errorf("%d/%d: stat: %v", tt.valid, tt.size, err)
+		}
+		_, err = fs.Stat("/big.bin")
+		if err != nil {
+			t.Errorf("%d/%d: entries after the set: %v", tt.valid, tt.size, err)
+		}
+		if tt.ok {
+			_, err = iofs.ReadFile(NewExFS(fs), "hello.txt")
+			if err != nil {
+				t.Errorf("%d/%d: read: %v", tt.valid, tt.size, err)
+			}
+		}
+	}
+}
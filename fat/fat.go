@@ -57,7 +57,7 @@ type Dir struct {
 	Name       [8]uint8
 	Ext        [3]uint8
 	Attr       uint8
-	_          uint8
+	Case       uint8
 	Ctimetenth uint8
 	Ctime      uint16
 	Cdate      uint16
@@ -90,10 +90,17 @@ const (
 	DEVICE
 )
 
+// NT case flags in Dir.Case, set when the base name or extension of
+// a short name without long name entries is all lower case
+const (
+	LOWER_BASE = 0x08
+	LOWER_EXT  = 0x10
+)
+
 func LFNChecksum(buf []byte) uint8 {
 	var sum uint8
-	for i := len(buf) - 1; i >= 0; i-- {
-		sum = ((sum & uint8(i)) << 7) + (sum >> 1) + buf[i]
+	for i := 0; i < len(buf) && i < 11; i++ {
+		sum = ((sum & 1) << 7) + (sum >> 1) + buf[i]
 	}
 	return sum
 }
\ No newline at end of file
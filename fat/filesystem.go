@@ -45,6 +45,10 @@ type FileSystem struct {
 	rootaddr    int64
 	rootstart   int64
 	fatclusters int64
+	nclusters   int64
+	nextfree    int64
+	infoaddr    int64
+	nfree       int64
 	label       string
 	fstype      string
 
@@ -53,65 +57,83 @@ type FileSystem struct {
 
 type FileSystemOptions struct {
 	Case bool
+
+	// Loc is the time zone timestamps without a UTC offset are in,
+	// defaults to time.Local
+	Loc *time.Location
+
+	// Codepage decodes and encodes short names, defaults to CP437
+	Codepage *Codepage
 }
 
 type File struct {
-	fs         *FileSystem
-	name       string
-	dir        Dir
-	dirstart   int64
-	startpos   int64
-	clusterpos int64
-	dirpos     int64
-	filepos    int64
-	off        int64
-	clusters   [][]int64
+	fs       *FileSystem
+	name     string
+	dir      Dir
+	dirstart int64
+	lfnaddrs []int64
+	startpos int64
+	dirpos   int64
+	off      int64
+	flag     int
+	root     bool
+	clusters [][]int64
 }
 
-func (f *File) Stat() (os.FileInfo, error) { return f, nil }
-
-func (f *File) Name() string     { return f.name }
-func (f *File) IsDir() bool      { return f.dir.Attr&DIRECTORY != 0 && f.dir.Attr != 0xF }
-func (f *File) Size() int64      { return int64(f.dir.Length) }
-func (f *File) Sys() interface{} { return f }
-func (f *File) Close() error     { return nil }
-
-func (f *File) ModTime() time.Time {
-	d := f.dir.Date
-	t := f.dir.Time
-	year := 1980 + (d>>9)&0x7f
-	month := (d >> 5) & 0xf
-	day := d & 0x1f
-	hour := (t >> 11) & 0x1f
-	min := (t >> 5) & 0x3f
-	sec := t & 0x3f
-	return time.Date(int(year), time.Month(month), int(day), int(hour),
-		int(min), int(sec), 0, time.Local)
+// a live entry in a directory, addr is the address of the short entry
+// and lfns the addresses of the long name entries preceding it
+type dirent struct {
+	addr   int64
+	lfns   []int64
+	name   string
+	short  string
+	dir    Dir
+	badsum bool
 }
 
-func (f *File) Mode() os.FileMode {
-	m := os.FileMode(0777)
-	v := f.dir.Attr
-	if v&DIRECTORY != 0 {
-		m |= os.ModeDir
-	}
+func (f *File) Stat() (os.FileInfo, error) { return f, nil }
 
-	if v&DEVICE != 0 {
-		m |= os.ModeDevice
+func (f *File) Name() string       { return f.name }
+func (f *File) IsDir() bool        { return f.dir.Attr&DIRECTORY != 0 && f.dir.Attr != 0xF }
+func (f *File) Size() int64        { return int64(f.dir.Length) }
+func (f *File) Mode() os.FileMode  { return f.Attr().Mode() }
+func (f *File) ModTime() time.Time { return f.Attr().Modified() }
+func (f *File) Sys() interface{}   { return f.Attr() }
+func (f *File) Close() error       { return nil }
+
+func (f *File) Attr() *Attr {
+	d := &f.dir
+	return &Attr{
+		Bits:       d.Attr,
+		Cdate:      d.Cdate,
+		Ctime:      d.Ctime,
+		Ctimetenth: d.Ctimetenth,
+		Mdate:      d.Date,
+		Mtime:      d.Time,
+		Adate:      d.Adate,
+		Loc:        f.fs.opt.Loc,
 	}
+}
 
-	if v&RDONLY != 0 {
-		m &^= 0333
+// SetAttr writes the attribute bits and timestamps back to the entry,
+// the directory and volume label bits can't be changed
+func (f *File) SetAttr(a *Attr) error {
+	if f.root {
+		return nil
 	}
 
-	return m
+	d := &f.dir
+	d.Attr = d.Attr&(DIRECTORY|VOLUME_LABEL) | a.Bits&^(DIRECTORY|VOLUME_LABEL)
+	d.Cdate, d.Ctime, d.Ctimetenth = a.Cdate, a.Ctime, a.Ctimetenth
+	d.Date, d.Time = a.Mdate, a.Mtime
+	d.Adate = a.Adate
+	return f.sync()
 }
 
 func (f *File) Seek(off int64, whence int) (int64, error) {
 	switch whence {
 	case io.SeekStart:
 		if f.IsDir() {
-			f.clusterpos = 0
 			f.dirpos = 0
 		}
 	case io.SeekCurrent:
@@ -126,58 +148,57 @@ func (f *File) Seek(off int64, whence int) (int64, error) {
 		return 0, os.ErrInvalid
 	}
 
-	f.clusterpos = off / (f.fs.clustersz * f.fs.sectsz)
-	f.filepos = off % (f.fs.clustersz * f.fs.sectsz)
 	f.off = off
 	return off, nil
 }
 
 func (f *File) Read(b []byte) (int, error) {
 	if f.IsDir() {
-		return 0, &os.PathError{"read", f.name, ErrIsDir}
+		return 0, &os.PathError{Op: "read", Path: f.name, Err: ErrIsDir}
 	}
-	if f.off >= int64(f.dir.Length) {
-		return 0, io.EOF
+
+	n, err := f.ReadAt(b, f.off)
+	f.off += int64(n)
+	if err == io.EOF && n > 0 {
+		err = nil
 	}
+	return n, err
+}
 
-	var n int
-	var err error
-	for n < len(b) && int64(n) < int64(f.dir.Length) {
-		if f.filepos >= f.fs.clustersz*f.fs.sectsz {
-			f.clusterpos++
-			f.filepos = 0
-		}
+func (f *File) ReadAt(b []byte, off int64) (int, error) {
+	if f.IsDir() {
+		return 0, &os.PathError{Op: "read", Path: f.name, Err: ErrIsDir}
+	}
 
-		off := f.fileAddr(f.clusterpos, f.filepos)
-		if off < 0 {
-			err = fmt.Errorf("encountered bad cluster %d at offset %d",
-				f.clusterpos, f.filepos)
-			break
+	size := int64(f.dir.Length)
+	cb := f.fs.clusterBytes()
+	n := 0
+	for n < len(b) && off < size {
+		addr := f.fileAddr(off/cb, off%cb)
+		if addr < 0 {
+			return n, fmt.Errorf("encountered bad cluster %d at offset %d", off/cb, off%cb)
 		}
-		sr := io.NewSectionReader(f.fs.rw, off, math.MaxUint32)
 
-		m := len(b) - n
-		if int64(f.dir.Length)-int64(n) < int64(m) {
-			m = int(f.dir.Length) - n
+		m := int64(len(b) - n)
+		if m > cb-off%cb {
+			m = cb - off%cb
 		}
-		if int64(m) > f.fs.clustersz*f.fs.sectsz {
-			m = int(f.fs.clustersz * f.fs.sectsz)
+		if m > size-off {
+			m = size - off
 		}
 
-		nr, err := sr.Read(b[n : n+m])
+		nr, err := f.fs.rw.ReadAt(b[n:n+int(m)], addr)
 		n += nr
-		f.filepos += int64(nr)
+		off += int64(nr)
 		if err != nil {
-			break
+			return n, err
 		}
 	}
 
-	f.off += int64(n)
-	return n, err
-}
-
-func (f *File) Write(b []byte) (int, error) {
-	return 0, nil
+	if n < len(b) {
+		return n, io.EOF
+	}
+	return n, nil
 }
 
 func (f *File) fileAddr(n, off int64) int64 {
@@ -188,14 +209,24 @@ func (f *File) fileAddr(n, off int64) int64 {
 			break
 		}
 	}
-	if cluster < 0 {
+	if cluster < 2 {
 		return -1
 	}
+	return (f.startpos+(cluster-2)*f.fs.clustersz)*f.fs.sectsz + off
+}
 
-	if cluster >= 2 {
-		cluster -= 2
+// the root directory of FAT12/16 lives in a fixed area
+// in front of the data area instead of a cluster chain
+func (f *File) slotAddr(pos int64) int64 {
+	if f.root && f.fs.fatbits != 32 {
+		if pos >= f.fs.rootsz*fatDirsz {
+			return -1
+		}
+		return f.fs.rootaddr*f.fs.sectsz + pos
 	}
-	return (f.startpos+cluster*f.fs.clustersz)*f.fs.sectsz + off
+
+	cb := f.fs.clusterBytes()
+	return f.fileAddr(pos/cb, pos%cb)
 }
 
 func (f *File) calcClusters() {
@@ -204,173 +235,188 @@ func (f *File) calcClusters() {
 		cluster |= int64(uint(f.dir.Cluster32) << 16)
 	}
 
+	// empty files and the fixed root directory have no chain
 	f.clusters = f.clusters[:0]
 	for i := int64(0); i < f.fs.nfats; i++ {
-		var clusters []int64
-		switch f.fs.fatbits {
-		case 12:
-			clusters = append(clusters, f.getClusters12(i, cluster)...)
-		case 16, 32:
-			clusters = append(clusters, f.getClusters16or32(i, cluster, f.fs.fatbits)...)
-		}
-		f.clusters = append(f.clusters, clusters)
-	}
-	return
-}
-
-func (f *File) getClusters12(fatnum, cluster int64) (clusters []int64) {
-	seen := make(map[uint16]bool)
-	for {
-		clusters = append(clusters, cluster)
-
-		addr := (f.fs.fataddr+fatnum*f.fs.fatsz)*f.fs.sectsz + cluster + (cluster / 2)
-		sr := io.NewSectionReader(f.fs.rw, addr, math.MaxUint32)
-
-		var v uint16
-		err := binary.Read(sr, binary.LittleEndian, &v)
-		if cluster&0x1 != 0 {
-			v >>= 4
-		} else {
-			v &= 0xfff
+		if cluster < 2 {
+			f.clusters = append(f.clusters, nil)
+			continue
 		}
 
-		if err != nil || v >= 0xff7 || seen[v] {
-			break
-		}
-
-		cluster = int64(v)
-		seen[v] = true
+		f.clusters = append(f.clusters, f.getClusters(i, cluster))
 	}
-	return
 }
 
-func (f *File) getClusters16or32(fatnum, cluster, bits int64) (clusters []int64) {
+// getClusters follows the chain in FAT copy fatnum, it stops at the end of
+// chain marker, a bad cluster, a free or out of range entry or a loop
+func (f *File) getClusters(fatnum, cluster int64) (clusters []int64) {
 	seen := make(map[int64]bool)
-	for {
+	for cluster >= 2 && cluster <= f.fs.maxCluster() && !seen[cluster] {
 		clusters = append(clusters, cluster)
+		seen[cluster] = true
 
-		addr := (f.fs.fataddr+fatnum*f.fs.fatsz)*f.fs.sectsz + cluster*(bits/8)
-		sr := io.NewSectionReader(f.fs.rw, addr, math.MaxUint32)
-
-		var v int64
-		var err error
-		if bits == 16 {
-			var u uint16
-			err = binary.Read(sr, binary.LittleEndian, &u)
-			v = int64(u)
-			if v >= 0xfff7 {
-				break
-			}
-		} else {
-			var u uint32
-			err = binary.Read(sr, binary.LittleEndian, &u)
-			v = int64(u) & 0x7ffffff
-			if v >= 0xffffff7 {
-				break
-			}
-		}
-		if err != nil || seen[v] {
+		v, err := f.fs.readFAT(fatnum, cluster)
+		if err != nil || f.fs.isEOC(v) || v == f.fs.badCluster() {
 			break
 		}
-
 		cluster = v
-		seen[v] = true
 	}
 	return
 }
 
 func (f *File) Readdir(n int) ([]os.FileInfo, error) {
 	if !f.IsDir() {
-		return nil, &os.PathError{"readdir", f.name, ErrNotDir}
+		return nil, &os.PathError{Op: "readdir", Path: f.name, Err: ErrNotDir}
 	}
 
-	var (
-		lfns []LFN
-		dir  Dir
-		buf  [fatDirsz]byte
-		fis  []os.FileInfo
-	)
-
+	var fis []os.FileInfo
+	want := n
 	if n <= 0 {
 		n = -1
 	}
-
 	for n != 0 {
-		if f.dirpos+fatDirsz >= f.fs.sectsz*f.fs.clustersz {
-			f.clusterpos++
-			f.dirpos = 0
-		}
-
-		addr := f.fileAddr(f.clusterpos, f.dirpos)
-		if addr < 0 {
-			return fis, fmt.Errorf("encountered invalid FAT clusters")
+		e, pos, err := f.next(f.dirpos)
+		f.dirpos = pos
+		if err == io.EOF {
+			break
 		}
-		sr := io.NewSectionReader(f.fs.rw, addr, math.MaxUint32)
-		err := binary.Read(sr, binary.LittleEndian, &buf)
 		if err != nil {
 			return fis, err
 		}
 
-		if buf[0] == 0 {
-			if len(fis) == 0 {
-				return nil, io.EOF
-			}
-			break
+		if e.dir.Attr&VOLUME_LABEL != 0 && e.dir.Attr&DIRECTORY == 0 || e.dot() {
+			continue
 		}
+		fis = append(fis, f.child(e))
+		n--
+	}
+
+	if want > 0 && len(fis) == 0 {
+		return nil, io.EOF
+	}
+	return fis, nil
+}
 
-		f.dirpos += fatDirsz
-		if n > 0 {
-			n--
+// next returns the next live entry at or after the byte offset pos of the
+// directory, along with the offset following it
+func (f *File) next(pos int64) (*dirent, int64, error) {
+	var (
+		lfns  []LFN
+		addrs []int64
+		buf   [fatDirsz]byte
+	)
+	for ; ; pos += fatDirsz {
+		addr := f.slotAddr(pos)
+		if addr < 0 {
+			return nil, pos, io.EOF
+		}
+		_, err := f.fs.rw.ReadAt(buf[:], addr)
+		if err != nil {
+			return nil, pos, err
 		}
 
 		bp := bytes.NewReader(buf[:])
 		switch {
-		case buf[11]&0xf == 0xf: // lfn
+		case buf[0] == 0:
+			return nil, pos, io.EOF
+
+		case buf[0] == 0xe5: // deleted
+			lfns, addrs = lfns[:0], addrs[:0]
+
+		case buf[11]&0x3f == 0xf: // lfn
 			var lfn LFN
 			binary.Read(bp, binary.LittleEndian, &lfn)
-			if lfn.Cluster == 0 && (lfn.Name1[0] != 0 || lfn.Name1[1] != 0) {
-				lfns = append(lfns, lfn)
+			if lfn.Seq&0x40 != 0 {
+				lfns, addrs = lfns[:0], addrs[:0]
 			}
-
-		case buf[11]&0x2 != 0: // hidden
-			lfns = lfns[:0]
-
-		case buf[0] == 0xe5: // deleted
-			lfns = lfns[:0]
+			lfns = append(lfns, lfn)
+			addrs = append(addrs, addr)
 
 		default:
-			binary.Read(bp, binary.LittleEndian, &dir)
-
-			var name string
+			e := &dirent{addr: addr}
+			binary.Read(bp, binary.LittleEndian, &e.dir)
+			e.short = f.fs.shortName(&e.dir)
+			e.name = e.short
 			if len(lfns) > 0 {
-				name = lfnName(lfns)
-				lfns = lfns[:0]
-			} else {
-				name = string(dir.Name[:])
-				name = strings.TrimRight(name, " ")
-
-				ext := string(dir.Ext[:])
-				ext = strings.TrimRight(ext, " ")
-				if ext != "" {
-					name += "." + ext
-				}
-
-				name = strings.ToLower(name)
-			}
-			if name != "." && name != ".." {
-				fi := &File{
-					fs:       f.fs,
-					name:     name,
-					dirstart: addr,
-					startpos: f.fs.dataaddr,
-					dir:      dir,
+				if lfns[0].Checksum == LFNChecksum(buf[:11]) {
+					e.name = lfnName(lfns)
+					e.lfns = addrs
+				} else {
+					e.badsum = true
 				}
-				fi.calcClusters()
-				fis = append(fis, fi)
 			}
+			return e, pos + fatDirsz, nil
 		}
 	}
-	return fis, nil
+}
+
+func (f *File) lookup(name string) (*dirent, error) {
+	for pos := int64(0); ; {
+		e, next, err := f.next(pos)
+		if err == io.EOF {
+			return nil, os.ErrNotExist
+		}
+		if err != nil {
+			return nil, err
+		}
+		pos = next
+
+		if e.dir.Attr&VOLUME_LABEL != 0 && e.dir.Attr&DIRECTORY == 0 {
+			continue
+		}
+		if f.fs.compareName(e.name, name) == 0 || strings.EqualFold(e.short, name) {
+			return e, nil
+		}
+	}
+}
+
+func (f *File) child(e *dirent) *File {
+	c := &File{
+		fs:       f.fs,
+		name:     e.name,
+		dir:      e.dir,
+		dirstart: e.addr,
+		lfnaddrs: e.lfns,
+		startpos: f.fs.dataaddr,
+	}
+	c.calcClusters()
+	return c
+}
+
+func (e *dirent) dot() bool {
+	return e.short == "." || e.short == ".."
+}
+
+// shortName decodes the 8.3 name, upper case unless the NT case flags
+// say a part is lower case
+func (fs *FileSystem) shortName(dir *Dir) string {
+	var b [11]byte
+	copy(b[:], dir.Name[:])
+	copy(b[8:], dir.Ext[:])
+	if b[0] == 0x05 {
+		b[0] = 0xe5
+	}
+
+	cp := fs.codepage()
+	name := strings.TrimRight(cp.Decode(b[:8]), " ")
+	ext := strings.TrimRight(cp.Decode(b[8:]), " ")
+	if dir.Case&LOWER_BASE != 0 {
+		name = strings.ToLower(name)
+	}
+	if dir.Case&LOWER_EXT != 0 {
+		ext = strings.ToLower(ext)
+	}
+	if ext != "" {
+		name += "." + ext
+	}
+	return name
+}
+
+func (fs *FileSystem) codepage() *Codepage {
+	if fs.opt.Codepage != nil {
+		return fs.opt.Codepage
+	}
+	return &CP437
 }
 
 func NewFileSystem(rw iod.RW, opt *FileSystemOptions) (*FileSystem, error) {
@@ -396,6 +442,9 @@ func NewFileSystem(rw iod.RW, opt *FileSystemOptions) (*FileSystem, error) {
 	if err != nil {
 		return nil, err
 	}
+	if string(pbs.Version[:]) == "EXFAT   " {
+		return nil, ErrExFAT
+	}
 
 	fs.sectsz = int64(pbs.Sectsz)
 	fs.clustersz = int64(pbs.Clustersz)
@@ -419,43 +468,55 @@ func NewFileSystem(rw iod.RW, opt *FileSystemOptions) (*FileSystem, error) {
 		fs.dataaddr = fs.fataddr + fs.nfats*fs.fatsz
 		fs.rootstart = int64(pbs32.Rootstart)
 
+		// with mirroring disabled only the active FAT is used
 		if ext := pbs32.Extflags; ext&0x80 != 0 {
-			for i := uint(0); i < 4; i++ {
-				if ext&(1<<i) != 0 {
-					fs.fataddr += int64(i) * fs.fatsz
-					fs.nfats = 1
-					break
-				}
-			}
+			fs.fataddr += int64(ext&0xf) * fs.fatsz
+			fs.nfats = 1
 		}
-		fs.label = strings.TrimRight(string(pbs.Label[:]), "\x00")
-		fs.fstype = strings.TrimRight(string(pbs.Fstype[:]), "\x00")
+		fs.rootaddr = fs.dataaddr + (fs.rootstart-2)*fs.clustersz
+		fs.label = strings.TrimRight(string(pbs32.Label[:]), "\x00 ")
+		fs.fstype = strings.TrimRight(string(pbs32.Fstype[:]), "\x00 ")
 	} else {
 		fs.rootaddr = fs.fataddr + fs.nfats*fs.fatsz
 		i := fs.rootsz*fatDirsz + fs.sectsz - 1
 		i /= fs.sectsz
 		fs.dataaddr = fs.rootaddr + i
-		fs.label = strings.TrimRight(string(pbs.Label[:]), "\x00")
-		fs.fstype = strings.TrimRight(string(pbs.Fstype[:]), "\x00")
+		fs.label = strings.TrimRight(string(pbs.Label[:]), "\x00 ")
+		fs.fstype = strings.TrimRight(string(pbs.Fstype[:]), "\x00 ")
 	}
-	fs.fatclusters = fs.nresrv + (fs.volsz-fs.dataaddr)/fs.clustersz
+	fs.fatclusters = (fs.volsz - fs.dataaddr) / fs.clustersz
 
 	if fs.fatbits != 32 {
-		if fs.fatclusters < 4087 {
+		if fs.fatclusters < 4085 {
 			fs.fatbits = 12
 		} else {
 			fs.fatbits = 16
 		}
 	}
+	fs.nclusters = (fs.volsz - fs.dataaddr) / fs.clustersz
+	if n := fs.fatsz * fs.sectsz * 8 / fs.fatbits; fs.nclusters > n-2 {
+		fs.nclusters = n - 2
+	}
+	fs.nextfree = 2
+
+	if fs.fatbits == 32 && pbs32.Infospec != 0 && pbs32.Infospec != 0xffff {
+		fs.readInfo(int64(pbs32.Infospec) * fs.sectsz)
+	}
+
 	fs.rootdir = File{
 		fs:       fs,
 		name:     "/",
 		startpos: fs.rootaddr,
+		root:     true,
 		dir: Dir{
 			Name: [8]byte{'/'},
 			Attr: DIRECTORY,
 		},
 	}
+	if fs.fatbits == 32 {
+		fs.rootdir.startpos = fs.dataaddr
+		fs.rootdir.setStart(fs.rootstart)
+	}
 	fs.rootdir.calcClusters()
 
 	return fs, nil
@@ -472,12 +533,28 @@ func (fs *FileSystem) Chmod(name string, mode os.FileMode) error {
 	}
 	defer f.Close()
 
-	if mode&0444 == 0444 {
+	if f.root {
+		return nil
+	}
+	if mode&0222 == 0 {
 		f.dir.Attr |= RDONLY
 	} else {
 		f.dir.Attr &^= RDONLY
 	}
-	return nil
+	_, err = fs.rw.WriteAt([]byte{f.dir.Attr}, f.dirstart+11)
+	return err
+}
+
+func (fs *FileSystem) Chtimes(name string, atime, mtime time.Time) error {
+	f, err := fs.Open(name)
+	if err != nil {
+		return err
+	}
+
+	a := f.Attr()
+	a.SetAccessed(atime)
+	a.SetModified(mtime)
+	return f.SetAttr(a)
 }
 
 func (fs *FileSystem) Chdir(dir string) error {
@@ -487,7 +564,7 @@ func (fs *FileSystem) Chdir(dir string) error {
 	}
 
 	if !f.IsDir() {
-		return &os.PathError{"chdir", dir, ErrNotDir}
+		return &os.PathError{Op: "chdir", Path: dir, Err: ErrNotDir}
 	}
 	fs.cwd = stdpath.Clean(dir)
 
@@ -503,6 +580,24 @@ func (fs *FileSystem) Lstat(name string) (os.FileInfo, error) {
 }
 
 func (fs *FileSystem) Mkdir(name string, perm os.FileMode) error {
+	name = fs.abs(name)
+	dir, base := stdpath.Split(name)
+	parent, err := fs.walk(dir)
+	if err != nil {
+		return &os.PathError{Op: "mkdir", Path: name, Err: err}
+	}
+	if !parent.IsDir() {
+		return &os.PathError{Op: "mkdir", Path: name, Err: ErrNotDir}
+	}
+
+	attr := uint8(DIRECTORY)
+	if perm&0222 == 0 {
+		attr |= RDONLY
+	}
+	_, err = fs.create(parent, base, attr)
+	if err != nil {
+		return &os.PathError{Op: "mkdir", Path: name, Err: err}
+	}
 	return nil
 }
 
@@ -512,7 +607,7 @@ func (fs *FileSystem) MkdirAll(path string, perm os.FileMode) error {
 		if dir.IsDir() {
 			return nil
 		}
-		return &os.PathError{"mkdir", path, ErrNotDir}
+		return &os.PathError{Op: "mkdir", Path: path, Err: ErrNotDir}
 	}
 
 	i := len(path)
@@ -553,37 +648,86 @@ func (fs *FileSystem) Create(name string) (*File, error) {
 }
 
 func (fs *FileSystem) OpenFile(name string, flag int, perm os.FileMode) (*File, error) {
+	name = fs.abs(name)
+	f, err := fs.walk(name)
+	switch {
+	case err == os.ErrNotExist && flag&os.O_CREATE != 0:
+		dir, base := stdpath.Split(name)
+		parent, err := fs.walk(dir)
+		if err != nil {
+			return nil, &os.PathError{Op: "open", Path: name, Err: err}
+		}
+		if !parent.IsDir() {
+			return nil, &os.PathError{Op: "open", Path: name, Err: ErrNotDir}
+		}
+
+		attr := uint8(ARCHIVE)
+		if perm&0222 == 0 {
+			attr |= RDONLY
+		}
+		f, err = fs.create(parent, base, attr)
+		if err != nil {
+			return nil, &os.PathError{Op: "open", Path: name, Err: err}
+		}
+
+	case err != nil:
+		return nil, &os.PathError{Op: "open", Path: name, Err: err}
+
+	case flag&(os.O_CREATE|os.O_EXCL) == os.O_CREATE|os.O_EXCL:
+		return nil, &os.PathError{Op: "open", Path: name, Err: os.ErrExist}
+	}
+
+	f.flag = flag
+	if f.writable() {
+		if f.IsDir() {
+			return nil, &os.PathError{Op: "open", Path: name, Err: ErrIsDir}
+		}
+		if f.dir.Attr&RDONLY != 0 {
+			return nil, &os.PathError{Op: "open", Path: name, Err: os.ErrPermission}
+		}
+	}
+	if flag&os.O_TRUNC != 0 && f.writable() {
+		err = f.Truncate(0)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return f, nil
+}
+
+func (fs *FileSystem) abs(name string) string {
 	if stdpath.IsAbs(name) {
-		name = stdpath.Clean(name)
-	} else {
-		name = stdpath.Join(fs.cwd, name)
+		return stdpath.Clean(name)
 	}
+	return stdpath.Join(fs.cwd, name)
+}
 
+func (fs *FileSystem) root() *File {
 	f := &File{}
 	*f = fs.rootdir
+	f.clusters = nil
+	f.calcClusters()
+	return f
+}
+
+func (fs *FileSystem) walk(name string) (*File, error) {
+	f := fs.root()
+	name = stdpath.Clean(name)
 	if name == "/" {
 		return f, nil
 	}
 
 	p := splitPath(name)
 	for i := len(p) - 1; i >= 0; i-- {
-	loop:
-		for {
-			fi, err := f.Readdir(1024)
-			if err == io.EOF {
-				return nil, &os.PathError{"open", name, os.ErrNotExist}
-			}
-			if err != nil {
-				return nil, err
-			}
-
-			for _, fi := range fi {
-				if fs.compareName(fi.Name(), p[i]) == 0 {
-					f = fi.(*File)
-					break loop
-				}
-			}
+		if !f.IsDir() {
+			return nil, ErrNotDir
+		}
+		e, err := f.lookup(p[i])
+		if err != nil {
+			return nil, err
 		}
+		f = f.child(e)
 	}
 
 	return f, nil
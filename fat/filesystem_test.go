@@ -0,0 +1,328 @@
+package fat
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// the files genfat.go puts on every image
+var (
+	readmeData = "hello, world\n"
+	longData   = strings.Repeat("The quick brown fox jumps over the lazy dog.\n", 67)[:3000]
+	innerData  = "inside\n"
+)
+
+func rootNames() []string {
+	names := []string{"Long File Name.txt", "README.TXT", "SUB"}
+	for i := 0; i < 18; i++ {
+		names = append(names, fmt.Sprintf("FILE%02d.TXT", i))
+	}
+	sort.Strings(names)
+	return names
+}
+
+func openImage(t *testing.T, bits int) (memDisk, *FileSystem) {
+	t.Helper()
+	d := loadImage(t, fmt.Sprintf("fat%d.img.gz", bits))
+	fs, err := NewFileSystem(d, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fs.fatbits != int64(bits) {
+		t.Fatalf("FAT%d: detected as FAT%d", bits, fs.fatbits)
+	}
+	return d, fs
+}
+
+func readFile(t *testing.T, fs *FileSystem, name string) string {
+	t.Helper()
+	f, err := fs.Open(name)
+	if err != nil {
+		t.Fatalf("FAT%d: %v", fs.fatbits, err)
+	}
+	b, err := io.ReadAll(f)
+	if err != nil {
+		t.Fatalf("FAT%d: %s: %v", fs.fatbits, name, err)
+	}
+	return string(b)
+}
+
+func TestReadImage(t *testing.T) {
+	for _, bits := range []int{12, 16, 32} {
+		_, fs := openImage(t, bits)
+		if fs.label != "TESTVOL" {
+			t.Errorf("FAT%d: label %q", bits, fs.label)
+		}
+
+		root, err := fs.Open("/")
+		if err != nil {
+			t.Fatal(err)
+		}
+		fis, err := root.Readdir(0)
+		if err != nil {
+			t.Fatalf("FAT%d: %v", bits, err)
+		}
+		var names []string
+		for _, fi := range fis {
+			names = append(names, fi.Name())
+		}
+		sort.Strings(names)
+		if !reflect.DeepEqual(names, rootNames()) {
+			t.Errorf("FAT%d: root has %q", bits, names)
+		}
+
+		for name, want := range map[string]string{
+			"/README.TXT":         readmeData,
+			"/Long File Name.txt": longData,
+			"/long file name.TXT": longData,
+			"/LONGFI~1.TXT":       longData,
+			"/SUB/INNER.TXT":      innerData,
+		} {
+			if got := readFile(t, fs, name); got != want {
+				t.Errorf("FAT%d: %s: read %d bytes, want %d", bits, name, len(got), len(want))
+			}
+		}
+	}
+}
+
+func TestClusterChain(t *testing.T) {
+	for _, bits := range []int{12, 16, 32} {
+		_, fs := openImage(t, bits)
+
+		// README.TXT ends with the all ones marker, on FAT32 including the
+		// reserved top bits, the long file with the lowest end marker
+		cb := fs.clusterBytes()
+		long := []int64{10, 11, 12, 20, 21, 22}[:(int64(len(longData))+cb-1)/cb]
+		for name, want := range map[string][]int64{
+			"/README.TXT":         {3},
+			"/Long File Name.txt": long,
+			"/SUB":                {5},
+		} {
+			f, err := fs.Open(name)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(f.clusters) != 2 {
+				t.Fatalf("FAT%d: %s: %d chains", bits, name, len(f.clusters))
+			}
+			for i, c := range f.clusters {
+				if !reflect.DeepEqual(c, want) {
+					t.Errorf("FAT%d: %s: FAT %d chain %v, want %v", bits, name, i, c, want)
+				}
+			}
+		}
+
+		// the chain stops at a bad cluster
+		var f File
+		f.fs = fs
+		if c := f.getClusters(0, 30); !reflect.DeepEqual(c, []int64{30}) {
+			t.Errorf("FAT%d: bad cluster chain %v", bits, c)
+		}
+
+		root := fs.root()
+		want := [][]int64{nil, nil}
+		if bits == 32 {
+			want = [][]int64{{2, 40}, {2, 40}}
+		}
+		if !reflect.DeepEqual(root.clusters, want) {
+			t.Errorf("FAT%d: root chain %v, want %v", bits, root.clusters, want)
+		}
+	}
+}
+
+func TestEOC(t *testing.T) {
+	for _, tt := range []struct {
+		bits int64
+		eoc  []int64
+		not  []int64
+	}{
+		{12, []int64{0xff8, 0xffc, 0xfff}, []int64{0xff7, 0xff0, 2}},
+		{16, []int64{0xfff8, 0xffff}, []int64{0xfff7, 0xff8, 2}},
+		{32, []int64{0xffffff8, 0xfffffff}, []int64{0xffffff7, 0xfff8, 2}},
+	} {
+		fs := &FileSystem{fatbits: tt.bits}
+		for _, v := range tt.eoc {
+			if !fs.isEOC(v) {
+				t.Errorf("FAT%d: %#x is not end of chain", tt.bits, v)
+			}
+		}
+		for _, v := range tt.not {
+			if fs.isEOC(v) {
+				t.Errorf("FAT%d: %#x is end of chain", tt.bits, v)
+			}
+		}
+		if bad := fs.badCluster(); bad != tt.not[0] {
+			t.Errorf("FAT%d: bad cluster %#x, want %#x", tt.bits, bad, tt.not[0])
+		}
+	}
+}
+
+func TestWriteImage(t *testing.T) {
+	data := bytes.Repeat([]byte("0123456789"), 1200)
+	for _, bits := range []int{12, 16, 32} {
+		d, fs := openImage(t, bits)
+
+		// the FAT32 root has to grow past its two clusters for these
+		for i := 0; i < 12; i++ {
+			f, err := fs.Create(fmt.Sprintf("/New File %d.dat", i))
+			if err != nil {
+				t.Fatalf("FAT%d: %v", bits, err)
+			}
+			_, err = f.Write(data[:i*1000])
+			if err != nil {
+				t.Fatalf("FAT%d: %v", bits, err)
+			}
+		}
+
+		fs, err := NewFileSystem(d, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i := 0; i < 12; i++ {
+			name := fmt.Sprintf("/New File %d.dat", i)
+			if got := readFile(t, fs, name); got != string(data[:i*1000]) {
+				t.Errorf("FAT%d: %s: read %d bytes", bits, name, len(got))
+			}
+		}
+		if got := readFile(t, fs, "/Long File Name.txt"); got != longData {
+			t.Errorf("FAT%d: long file changed", bits)
+		}
+
+		fat0, err := fs.loadFAT(0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		fat1, err := fs.loadFAT(1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(fat0, fat1) {
+			t.Errorf("FAT%d: FAT copies differ", bits)
+		}
+	}
+}
+
+func TestActiveFAT(t *testing.T) {
+	d := loadImage(t, "fat32.img.gz")
+
+	// only FAT 1 is used and FAT 0 holds nothing
+	binary.LittleEndian.PutUint16(d[40:], 0x81)
+	fatsz := int64(binary.LittleEndian.Uint32(d[36:]))
+	fat0 := d[32*512 : (32+fatsz)*512]
+	for i := range fat0 {
+		fat0[i] = 0
+	}
+
+	fs, err := NewFileSystem(d, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fs.nfats != 1 {
+		t.Errorf("%d FATs in use", fs.nfats)
+	}
+	if got := readFile(t, fs, "/Long File Name.txt"); got != longData {
+		t.Errorf("read %d bytes from the active FAT", len(got))
+	}
+
+	f, err := fs.Create("/new.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = f.Write([]byte(longData))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := readFile(t, fs, "/new.txt"); got != longData {
+		t.Errorf("read back %d bytes", len(got))
+	}
+	for _, c := range fat0 {
+		if c != 0 {
+			t.Fatal("write went to the inactive FAT")
+		}
+	}
+}
+
+func TestClusterThresholds(t *testing.T) {
+	for _, tt := range []struct {
+		bits     int
+		sectors  int64
+		clusters int64
+	}{
+		{12, 4141, 4084},
+		{12, 4142, -1},
+		{16, 4149, -1},
+		{16, 4150, 4085},
+		{16, 66069, 65524},
+		{16, 66070, -1},
+		{32, 66580, -1},
+		{32, 66581, 65525},
+	} {
+		d := make(memDisk, tt.sectors*512)
+		err := Format(d, &FormatOptions{Bits: tt.bits, Clustersz: 1})
+		if tt.clusters < 0 {
+			if err != ErrFormatSize {
+				t.Errorf("FAT%d %d sectors: got %v, want %v", tt.bits, tt.sectors, err, ErrFormatSize)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("FAT%d %d sectors: %v", tt.bits, tt.sectors, err)
+		}
+
+		fs, err := NewFileSystem(d, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if fs.fatbits != int64(tt.bits) || fs.fatclusters != tt.clusters {
+			t.Errorf("FAT%d %d sectors: FAT%d with %d clusters, want %d", tt.bits, tt.sectors, fs.fatbits, fs.fatclusters, tt.clusters)
+		}
+	}
+}
+
+// failDisk fails reads of the bytes from bad up to bad+n
+type failDisk struct {
+	memDisk
+	bad, n int64
+}
+
+var errBadSector = errors.New("bad sector")
+
+func (d *failDisk) ReadAt(p []byte, off int64) (int, error) {
+	if off < d.bad+d.n && d.bad < off+int64(len(p)) {
+		return 0, errBadSector
+	}
+	return d.memDisk.ReadAt(p, off)
+}
+
+func TestRemoveReadError(t *testing.T) {
+	_, fs := openImage(t, 16)
+	d := &failDisk{memDisk: fs.rw.(memDisk)}
+	fs, err := NewFileSystem(d, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// SUB holds INNER.TXT in cluster 5, make it unreadable
+	d.bad, d.n = fs.clusterAddr(5), fs.clusterBytes()
+	for _, remove := range []func(string) error{fs.Remove, fs.RemoveAll} {
+		err = remove("/SUB")
+		if !errors.Is(err, errBadSector) {
+			t.Errorf("got %v, want %v", err, errBadSector)
+		}
+	}
+
+	d.n = 0
+	if got := readFile(t, fs, "/SUB/INNER.TXT"); got != innerData {
+		t.Errorf("INNER.TXT reads %q", got)
+	}
+	if err := fs.Remove("/SUB"); !errors.Is(err, ErrNotEmpty) {
+		t.Errorf("non-empty directory: got %v, want %v", err, ErrNotEmpty)
+	}
+}
@@ -0,0 +1,351 @@
+package fat
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/qeedquan/disktools/iod"
+)
+
+var (
+	ErrFormatSize = errors.New("volume size out of range for the FAT type")
+	ErrFormatOpt  = errors.New("invalid format options")
+)
+
+type FormatOptions struct {
+	Bits        int    // 12, 16 or 32, 0 picks one from the size
+	Size        int64  // volume size in bytes, 0 asks the device
+	Sectsz      int    // defaults to 512
+	Clustersz   int    // sectors per cluster, 0 picks one from the size
+	NumFats     int    // defaults to 2
+	RootEntries int    // FAT12/16 root directory entries, defaults to 512
+	Media       uint8  // defaults to 0xf8
+	Hidden      uint32 // sectors preceding the volume, usually the partition start
+	Label       string
+	Serial      uint32 // 0 derives one from the current time
+	OEM         string
+}
+
+// Format writes an empty FAT filesystem to rw
+func Format(rw iod.RW, o *FormatOptions) error {
+	if o == nil {
+		o = &FormatOptions{}
+	}
+
+	sectsz := int64(o.Sectsz)
+	if sectsz == 0 {
+		sectsz = 512
+	}
+	if sectsz < 512 || sectsz > 4096 || sectsz&(sectsz-1) != 0 {
+		return ErrFormatOpt
+	}
+
+	size := o.Size
+	if size == 0 {
+		size = iod.Size(rw)
+	}
+	nsect := size / sectsz
+	if nsect < 64 || nsect > 0xffffffff {
+		return ErrFormatSize
+	}
+
+	bits := int64(o.Bits)
+	if bits == 0 {
+		switch {
+		case size < 16<<20:
+			bits = 12
+		case size < 512<<20:
+			bits = 16
+		default:
+			bits = 32
+		}
+	}
+
+	nfats := int64(o.NumFats)
+	if nfats == 0 {
+		nfats = 2
+	}
+	rootent := int64(o.RootEntries)
+	resv := int64(1)
+	if bits == 32 {
+		rootent = 0
+		resv = 32
+	} else if rootent == 0 {
+		rootent = 512
+	}
+	if bits != 12 && bits != 16 && bits != 32 || nfats > 4 || rootent > 0xffff ||
+		o.Clustersz&(o.Clustersz-1) != 0 || o.Clustersz > 128 {
+		return ErrFormatOpt
+	}
+
+	spc := int64(o.Clustersz)
+	if spc == 0 {
+		spc = clusterSize(bits, nsect*sectsz/512, sectsz)
+	}
+
+	// the FAT has to cover every cluster the data area can hold
+	rootsec := (rootent*fatDirsz + sectsz - 1) / sectsz
+	fatsz, nclust := int64(1), int64(0)
+	for {
+		nclust = (nsect - resv - nfats*fatsz - rootsec) / spc
+		if nclust <= 0 {
+			return ErrFormatSize
+		}
+		need := ((nclust+2)*bits + 7) / 8
+		if (need+sectsz-1)/sectsz <= fatsz {
+			break
+		}
+		fatsz++
+	}
+
+	switch {
+	case bits == 12 && nclust >= 4085,
+		bits == 16 && (nclust < 4085 || nclust >= 65525),
+		bits == 32 && (nclust < 65525 || nclust >= 0xffffff5):
+		return ErrFormatSize
+	}
+
+	media := o.Media
+	if media == 0 {
+		media = 0xf8
+	}
+	serial := o.Serial
+	if serial == 0 {
+		t := time.Now()
+		serial = uint32(t.Unix()) ^ uint32(t.Nanosecond())
+	}
+	oem := o.OEM
+	if oem == "" {
+		oem = "MSWIN4.1"
+	}
+	label := o.Label
+	if label == "" {
+		label = "NO NAME"
+	}
+	lab, ok := volumeLabel(label)
+	if !ok {
+		return ErrFormatOpt
+	}
+
+	var ver [8]byte
+	copy(ver[:], oem+strings.Repeat(" ", 8))
+
+	// clear the reserved sectors, the FATs and the fixed root directory
+	meta := resv + nfats*fatsz + rootsec
+	err := zeroSectors(rw, 0, meta, sectsz)
+	if err != nil {
+		return err
+	}
+
+	buf := new(bytes.Buffer)
+	if bits == 32 {
+		pbs := PBS32{
+			Magic:        [3]uint8{0xeb, 0x58, 0x90},
+			Version:      ver,
+			Sectsz:       uint16(sectsz),
+			Clustsz:      uint8(spc),
+			Resrv:        uint16(resv),
+			NumFats:      uint8(nfats),
+			Mediadesc:    media,
+			Trksz:        63,
+			Heads:        255,
+			Hidden:       o.Hidden,
+			Bigvolsz:     uint32(nsect),
+			Fatsz32:      uint32(fatsz),
+			Rootstart:    2,
+			Infospec:     1,
+			Backupboot:   6,
+			PhysDrive:    0x80,
+			ExtendedBoot: 0x29,
+			VolumeSerial: serial,
+			Label:        lab,
+		}
+		copy(pbs.Fstype[:], "FAT32   ")
+		binary.Write(buf, binary.LittleEndian, &pbs)
+	} else {
+		pbs := PBS{
+			Magic:     [3]uint8{0xeb, 0x3c, 0x90},
+			Version:   ver,
+			Sectsz:    uint16(sectsz),
+			Clustersz: uint8(spc),
+			Resrv:     uint16(resv),
+			NumFats:   uint8(nfats),
+			Rootsz:    uint16(rootent),
+			Mediadesc: media,
+			Fatsz:     uint16(fatsz),
+			Trksz:     63,
+			Heads:     255,
+			Hidden:    o.Hidden,
+			Driveno:   0x80,
+			Bootsig:   0x29,
+			Volid:     serial,
+			Label:     lab,
+		}
+		if nsect < 0x10000 {
+			pbs.Volsz = uint16(nsect)
+		} else {
+			pbs.Bigvolsz = uint32(nsect)
+		}
+		if bits == 12 {
+			copy(pbs.Fstype[:], "FAT12   ")
+		} else {
+			copy(pbs.Fstype[:], "FAT16   ")
+		}
+		binary.Write(buf, binary.LittleEndian, &pbs)
+	}
+
+	boot := make([]byte, sectsz)
+	copy(boot, buf.Bytes())
+	boot[510] = 0x55
+	boot[511] = 0xaa
+	_, err = rw.WriteAt(boot, 0)
+	if err != nil {
+		return err
+	}
+
+	if bits == 32 {
+		info := make([]byte, sectsz)
+		binary.LittleEndian.PutUint32(info[0:], fsinfoSig0)
+		binary.LittleEndian.PutUint32(info[484:], fsinfoSig1)
+		binary.LittleEndian.PutUint32(info[488:], uint32(nclust-1))
+		binary.LittleEndian.PutUint32(info[492:], 3)
+		info[510] = 0x55
+		info[511] = 0xaa
+		for _, n := range []int64{0, 6} {
+			_, err = rw.WriteAt(boot, n*sectsz)
+			if err == nil {
+				_, err = rw.WriteAt(info, (n+1)*sectsz)
+			}
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	// the first two entries hold the media descriptor and end of chain,
+	// the FAT32 root directory takes cluster 2
+	var ent []byte
+	switch bits {
+	case 12:
+		ent = []byte{media, 0xff, 0xff}
+	case 16:
+		ent = []byte{media, 0xff, 0xff, 0xff}
+	case 32:
+		ent = make([]byte, 12)
+		binary.LittleEndian.PutUint32(ent[0:], 0x0fffff00|uint32(media))
+		binary.LittleEndian.PutUint32(ent[4:], 0x0fffffff)
+		binary.LittleEndian.PutUint32(ent[8:], 0x0fffffff)
+	}
+	for i := int64(0); i < nfats; i++ {
+		_, err = rw.WriteAt(ent, (resv+i*fatsz)*sectsz)
+		if err != nil {
+			return err
+		}
+	}
+
+	rootaddr := (resv + nfats*fatsz) * sectsz
+	if bits == 32 {
+		err = zeroSectors(rw, meta, spc, sectsz)
+		if err != nil {
+			return err
+		}
+	}
+
+	if o.Label != "" {
+		dir := Dir{Attr: VOLUME_LABEL}
+		copy(dir.Name[:], lab[:8])
+		copy(dir.Ext[:], lab[8:])
+		dir.Date, dir.Time = dosTime(time.Now())
+		buf.Reset()
+		binary.Write(buf, binary.LittleEndian, &dir)
+		_, err = rw.WriteAt(buf.Bytes(), rootaddr)
+	}
+	return err
+}
+
+// volumeLabel upper cases s into the padded CP437 form of a label, it
+// takes the characters of a short name plus spaces that aren't leading
+func volumeLabel(s string) (lab [11]byte, ok bool) {
+	for i := range lab {
+		lab[i] = ' '
+	}
+	n := 0
+	for _, r := range s {
+		c, ok := CP437.Encode(unicode.ToUpper(r))
+		if !ok || n >= len(lab) || c < 0x20 || c == 0x7f || c == ' ' && n == 0 ||
+			strings.ContainsRune("\"*+,./:;<=>?[\\]|", r) {
+			return lab, false
+		}
+		lab[n] = c
+		n++
+	}
+	return lab, true
+}
+
+// clusterSize follows the Microsoft defaults, n is the size in 512 byte
+// sectors, larger sectors scale the result down
+func clusterSize(bits, n, sectsz int64) int64 {
+	var spc int64
+	switch bits {
+	case 12:
+		spc = 1
+		for n/spc >= 4000 && spc < 128 {
+			spc *= 2
+		}
+	case 16:
+		switch {
+		case n <= 32680:
+			spc = 2
+		case n <= 262144:
+			spc = 4
+		case n <= 524288:
+			spc = 8
+		case n <= 1048576:
+			spc = 16
+		case n <= 2097152:
+			spc = 32
+		default:
+			spc = 64
+		}
+	case 32:
+		switch {
+		case n <= 532480:
+			spc = 1
+		case n <= 16777216:
+			spc = 8
+		case n <= 33554432:
+			spc = 16
+		case n <= 67108864:
+			spc = 32
+		default:
+			spc = 64
+		}
+	}
+
+	spc = spc * 512 / sectsz
+	if spc < 1 {
+		spc = 1
+	}
+	return spc
+}
+
+func zeroSectors(rw iod.RW, lba, n, sectsz int64) error {
+	buf := make([]byte, 64*sectsz)
+	for n > 0 {
+		m := int64(len(buf)) / sectsz
+		if m > n {
+			m = n
+		}
+		_, err := rw.WriteAt(buf[:m*sectsz], lba*sectsz)
+		if err != nil {
+			return err
+		}
+		lba += m
+		n -= m
+	}
+	return nil
+}
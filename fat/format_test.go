@@ -0,0 +1,208 @@
+package fat
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"testing"
+)
+
+// memDisk is a fixed size in-memory image
+type memDisk []byte
+
+func (d memDisk) ReadAt(p []byte, off int64) (int, error) {
+	if off >= int64(len(d)) {
+		return 0, io.EOF
+	}
+	n := copy(p, d[off:])
+	if n < len(p) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+func (d memDisk) WriteAt(p []byte, off int64) (int, error) {
+	if off+int64(len(p)) > int64(len(d)) {
+		return 0, io.ErrShortWrite
+	}
+	return copy(d[off:], p), nil
+}
+
+func (d memDisk) Close() error { return nil }
+func (d memDisk) Size() int64  { return int64(len(d)) }
+
+func TestFormat(t *testing.T) {
+	tests := []struct {
+		bits int64
+		size int64
+	}{
+		{12, 4 << 20},
+		{16, 32 << 20},
+		{32, 64 << 20},
+	}
+	data := bytes.Repeat([]byte("0123456789abcdef"), 1000)
+	for _, tt := range tests {
+		d := make(memDisk, tt.size)
+		err := Format(d, &FormatOptions{Bits: int(tt.bits), Label: "test", Serial: 0x1234})
+		if err != nil {
+			t.Fatalf("FAT%d: %v", tt.bits, err)
+		}
+
+		fs, err := NewFileSystem(d, nil)
+		if err != nil {
+			t.Fatalf("FAT%d: %v", tt.bits, err)
+		}
+		if fs.fatbits != tt.bits {
+			t.Errorf("FAT%d: detected as FAT%d", tt.bits, fs.fatbits)
+		}
+		if fs.label != "TEST" {
+			t.Errorf("FAT%d: label %q", tt.bits, fs.label)
+		}
+		root, err := fs.Open("/")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if fis, err := root.Readdir(0); err != nil || len(fis) != 0 {
+			t.Errorf("FAT%d: new root has %v %v", tt.bits, fis, err)
+		}
+
+		err = fs.MkdirAll("/a/b", 0755)
+		if err != nil {
+			t.Fatal(err)
+		}
+		f, err := fs.Create("/a/b/data.bin")
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = f.Write(data)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		fs, err = NewFileSystem(d, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		f, err = fs.Open("/a/b/data.bin")
+		if err != nil {
+			t.Fatalf("FAT%d: %v", tt.bits, err)
+		}
+		got, err := io.ReadAll(f)
+		if err != nil || !bytes.Equal(got, data) {
+			t.Errorf("FAT%d: read back %d bytes, %v", tt.bits, len(got), err)
+		}
+	}
+}
+
+func TestFormatSize(t *testing.T) {
+	for _, o := range []*FormatOptions{
+		{Bits: 12, Size: 512 << 20},
+		{Bits: 32, Size: 4 << 20},
+		{Size: 16 << 10},
+	} {
+		err := Format(make(memDisk, 1<<20), o)
+		if err != ErrFormatSize {
+			t.Errorf("%+v: got %v, want %v", o, err, ErrFormatSize)
+		}
+	}
+}
+
+func TestWriteNoSpace(t *testing.T) {
+	d := make(memDisk, 200*512)
+	err := Format(d, &FormatOptions{Bits: 12, Clustersz: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	fs, err := NewFileSystem(d, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	small, err := fs.Create("/small.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = small.Write([]byte("kept"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	big, err := fs.Create("/big.bin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := bytes.Repeat([]byte{0x5a}, 300*512)
+	for _, f := range []*File{big, small} {
+		_, err = f.Write(data)
+		if !errors.Is(err, ErrNoSpace) {
+			t.Errorf("%s: got %v, want %v", f.Name(), err, ErrNoSpace)
+		}
+	}
+
+	fs, err = NewFileSystem(d, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	problems, err := Check(fs, nil)
+	if err != nil || len(problems) != 0 {
+		t.Errorf("after a failed write: %v %v", problems, err)
+	}
+	for name, want := range map[string]string{"/small.txt": "kept", "/big.bin": ""} {
+		f, err := fs.Open(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := io.ReadAll(f)
+		if err != nil || string(got) != want {
+			t.Errorf("%s: read %q %v, want %q", name, got, err, want)
+		}
+	}
+
+	// the freed clusters can be used again
+	f, err := fs.OpenFile("/big.bin", os.O_RDWR, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = f.Write(data[:100*512])
+	if err != nil {
+		t.Error(err)
+	}
+}
+
+func TestFormatLabel(t *testing.T) {
+	tests := []struct {
+		label string
+		want  string
+	}{
+		{"data", "DATA"},
+		{"My Disk", "MY DISK"},
+		{"ELEVENCHARS", "ELEVENCHARS"},
+		{"café", "CAFÉ"},
+		{"TWELVE CHARS", ""},
+		{" LEADING", ""},
+		{"A.B", ""},
+		{"A*B", ""},
+		{"tab\t", ""},
+		{"€URO", ""},
+	}
+	for _, tt := range tests {
+		d := make(memDisk, 4<<20)
+		err := Format(d, &FormatOptions{Label: tt.label})
+		if tt.want == "" {
+			if err != ErrFormatOpt {
+				t.Errorf("%q: got %v, want %v", tt.label, err, ErrFormatOpt)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("%q: %v", tt.label, err)
+		}
+		fs, err := NewFileSystem(d, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := CP437.Decode([]byte(fs.label)); got != tt.want {
+			t.Errorf("%q: label %q, want %q", tt.label, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,129 @@
+package fat
+
+import (
+	"io"
+	iofs "io/fs"
+	"os"
+	"sort"
+)
+
+// FS exposes a FileSystem or ExFileSystem through the io/fs interfaces,
+// names are unrooted slash separated paths relative to the root directory
+type FS struct {
+	walk func(name string) (node, error)
+}
+
+// node is what File and ExFile have in common
+type node interface {
+	Stat() (os.FileInfo, error)
+	Read([]byte) (int, error)
+	ReadAt([]byte, int64) (int, error)
+	Readdir(int) ([]os.FileInfo, error)
+	Close() error
+	IsDir() bool
+	Size() int64
+}
+
+type fsFile struct {
+	node
+	root bool
+}
+
+func NewFS(fs *FileSystem) *FS {
+	return &FS{func(name string) (node, error) {
+		f, err := fs.walk(name)
+		if err != nil {
+			return nil, err
+		}
+		return f, nil
+	}}
+}
+
+func NewExFS(fs *ExFileSystem) *FS {
+	return &FS{func(name string) (node, error) {
+		f, err := fs.walk(name)
+		if err != nil {
+			return nil, err
+		}
+		return f, nil
+	}}
+}
+
+func (f *FS) Open(name string) (iofs.File, error) {
+	fp, err := f.open("open", name)
+	if err != nil {
+		return nil, err
+	}
+	return fp, nil
+}
+
+func (f *FS) open(op, name string) (*fsFile, error) {
+	if !iofs.ValidPath(name) {
+		return nil, &iofs.PathError{Op: op, Path: name, Err: iofs.ErrInvalid}
+	}
+
+	fp, err := f.walk("/" + name)
+	if err != nil {
+		return nil, &iofs.PathError{Op: op, Path: name, Err: err}
+	}
+	return &fsFile{fp, name == "."}, nil
+}
+
+func (f *FS) Stat(name string) (iofs.FileInfo, error) {
+	fp, err := f.open("stat", name)
+	if err != nil {
+		return nil, err
+	}
+	return fp.Stat()
+}
+
+func (f *FS) ReadFile(name string) ([]byte, error) {
+	fp, err := f.open("read", name)
+	if err != nil {
+		return nil, err
+	}
+	if fp.IsDir() {
+		return nil, &iofs.PathError{Op: "read", Path: name, Err: ErrIsDir}
+	}
+
+	// the size comes from the image, let the buffer grow with what is
+	// actually read instead of allocating it up front
+	return io.ReadAll(io.NewSectionReader(fp, 0, fp.Size()))
+}
+
+func (f *FS) ReadDir(name string) ([]iofs.DirEntry, error) {
+	fp, err := f.open("readdir", name)
+	if err != nil {
+		return nil, err
+	}
+
+	ents, err := fp.ReadDir(-1)
+	sort.Slice(ents, func(i, j int) bool {
+		return ents[i].Name() < ents[j].Name()
+	})
+	return ents, err
+}
+
+func (f *fsFile) Stat() (iofs.FileInfo, error) {
+	fi, err := f.node.Stat()
+	if f.root && err == nil {
+		fi = rootInfo{fi}
+	}
+	return fi, err
+}
+
+func (f *fsFile) ReadDir(n int) ([]iofs.DirEntry, error) {
+	fis, err := f.Readdir(n)
+	ents := make([]iofs.DirEntry, len(fis))
+	for i := range fis {
+		ents[i] = iofs.FileInfoToDirEntry(fis[i])
+	}
+	return ents, err
+}
+
+// io/fs names the root "."
+type rootInfo struct {
+	os.FileInfo
+}
+
+func (rootInfo) Name() string { return "." }
@@ -0,0 +1,108 @@
+package fat
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	iofs "io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+)
+
+// loadImage reads a gzipped image from testdata into memory
+func loadImage(t *testing.T, name string) memDisk {
+	t.Helper()
+	f, err := os.Open(filepath.Join("testdata", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	z, err := gzip.NewReader(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := io.ReadAll(z)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return memDisk(b)
+}
+
+func TestFS(t *testing.T) {
+	d := make(memDisk, 4<<20)
+	err := Format(d, &FormatOptions{Bits: 12})
+	if err != nil {
+		t.Fatal(err)
+	}
+	fs, err := NewFileSystem(d, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = fs.MkdirAll("/docs/old", 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, data := range map[string]string{
+		"/readme.txt":           "hello\n",
+		"/docs/Long Name.md":    "# notes\n",
+		"/docs/old/archive.tar": string(bytes.Repeat([]byte{1, 2, 3}, 3000)),
+		"/docs/old/EMPTY":       "",
+	} {
+		f, err := fs.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = f.Write([]byte(data))
+		if err != nil {
+			t.Fatal(err)
+		}
+		f.Close()
+	}
+
+	fs, err = NewFileSystem(d, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = fstest.TestFS(NewFS(fs), "readme.txt", "docs/Long Name.md", "docs/old/archive.tar", "docs/old/EMPTY")
+	if err != nil {
+		t.Error(err)
+	}
+}
+
+func TestExFS(t *testing.T) {
+	fs, err := NewExFileSystem(loadImage(t, "exfat.img.gz"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fsys := NewExFS(fs)
+	err = fstest.TestFS(fsys, "hello.txt", "big.bin", "Secret", "Photos/IMG_0001.JPG")
+	if err != nil {
+		t.Error(err)
+	}
+
+	hello, err := iofs.ReadFile(fsys, "hello.txt")
+	if err != nil || !bytes.Equal(hello, bytes.Repeat([]byte("hello exfat! "), 500)[:6000]) {
+		t.Errorf("hello.txt: read %d bytes, %v", len(hello), err)
+	}
+
+	// past the valid data length reads as zeros, not what is on disk
+	big, err := iofs.ReadFile(fsys, "big.bin")
+	if err != nil || len(big) != 8192 {
+		t.Fatalf("big.bin: read %d bytes, %v", len(big), err)
+	}
+	for i, c := range big {
+		want := byte(i)
+		if i >= 5000 {
+			want = 0
+		}
+		if c != want {
+			t.Fatalf("big.bin: byte %d is %#x, want %#x", i, c, want)
+		}
+	}
+
+	if _, err := iofs.Stat(fsys, "deleted.txt"); err == nil {
+		t.Error("deleted.txt: deleted entry is visible")
+	}
+}
@@ -0,0 +1,205 @@
+//go:build ignore
+
+// genexfat writes a small exFAT test image independently of the fat
+// package. The root holds a label, the bitmap and upcase table, a
+// directory, a fragmented file, a file with a shorter valid length, a
+// deleted entry and a hidden empty file.
+//
+//	go run genexfat.go
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"log"
+	"os"
+	"unicode/utf16"
+)
+
+const (
+	sectsz   = 512
+	spc      = 8
+	cb       = sectsz * spc
+	volsz    = 32768
+	fatoff   = 128
+	fatlen   = 128
+	heapoff  = 256
+	clusters = (volsz - heapoff) / spc
+)
+
+var (
+	img = make([]byte, volsz*sectsz)
+	le  = binary.LittleEndian
+)
+
+func main() {
+	log.SetFlags(0)
+	boot()
+
+	setFAT(0, 0xfffffff8)
+	setFAT(1, 0xffffffff)
+	for _, c := range []int{2, 3, 4, 9, 10} {
+		setFAT(c, 0xffffffff)
+	}
+	setFAT(6, 9)
+
+	bitmap := make([]byte, (clusters+7)/8)
+	for c := 2; c <= 10; c++ {
+		bitmap[(c-2)/8] |= 1 << ((c - 2) % 8)
+	}
+	copy(img[addr(2):], bitmap)
+
+	// compressed table, only a-z map to A-Z
+	up := []uint16{0xffff, 'a'}
+	for c := 'A'; c <= 'Z'; c++ {
+		up = append(up, uint16(c))
+	}
+	up = append(up, 0xffff, 0x10000-'{')
+	upcase := make([]byte, 2*len(up))
+	for i, c := range up {
+		le.PutUint16(upcase[2*i:], c)
+	}
+	copy(img[addr(3):], upcase)
+
+	var root []byte
+	label := utf16.Encode([]rune("SDCARD"))
+	e := make([]byte, 32)
+	e[0], e[1] = 0x83, uint8(len(label))
+	for i, c := range label {
+		le.PutUint16(e[2+2*i:], c)
+	}
+	root = append(root, e...)
+
+	e = make([]byte, 32)
+	e[0] = 0x81
+	le.PutUint32(e[20:], 2)
+	le.PutUint64(e[24:], uint64(len(bitmap)))
+	root = append(root, e...)
+
+	e = make([]byte, 32)
+	e[0] = 0x82
+	le.PutUint32(e[4:], checksum(upcase, nil))
+	le.PutUint32(e[20:], 3)
+	le.PutUint64(e[24:], uint64(len(upcase)))
+	root = append(root, e...)
+
+	hello := bytes.Repeat([]byte("hello exfat! "), 500)[:6000]
+	big := bytes.Repeat(seq(256), 20)[:5000]
+	root = append(root, entrySet("Photos", 0x10, 5, cb, cb, true)...)
+	root = append(root, entrySet("hello.txt", 0x20, 6, len(hello), len(hello), false)...)
+	root = append(root, entrySet("big.bin", 0x20, 7, 8192, len(big), true)...)
+	e = entrySet("deleted.txt", 0x20, 0, 0, 0, false)
+	e[0] = 0x05
+	root = append(root, e...)
+	root = append(root, entrySet("Secret", 0x22, 0, 0, 0, false)...)
+	copy(img[addr(4):], root)
+
+	copy(img[addr(6):], hello[:cb])
+	copy(img[addr(9):], hello[cb:])
+	copy(img[addr(7):], big)
+	copy(img[addr(7)+len(big):addr(7)+8192], bytes.Repeat([]byte{0xaa}, 8192-len(big)))
+
+	copy(img[addr(5):], entrySet("IMG_0001.JPG", 0x20, 10, 100, 100, false))
+	copy(img[addr(10):], bytes.Repeat([]byte("J"), 100))
+
+	var buf bytes.Buffer
+	w, _ := gzip.NewWriterLevel(&buf, gzip.BestCompression)
+	w.Write(img)
+	w.Close()
+	err := os.WriteFile("exfat.img.gz", buf.Bytes(), 0644)
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+// boot writes the main and backup boot regions
+func boot() {
+	region := make([]byte, 11*sectsz)
+	b := region[:sectsz]
+	copy(b, "\xeb\x76\x90EXFAT   ")
+	le.PutUint64(b[72:], volsz)
+	le.PutUint32(b[80:], fatoff)
+	le.PutUint32(b[84:], fatlen)
+	le.PutUint32(b[88:], heapoff)
+	le.PutUint32(b[92:], clusters)
+	le.PutUint32(b[96:], 4)
+	le.PutUint32(b[100:], 0xdeadbeef)
+	le.PutUint16(b[104:], 0x100)
+	b[108], b[109], b[110], b[111] = 9, 3, 1, 0x80
+	for i := 0; i < 9; i++ {
+		region[i*sectsz+510], region[i*sectsz+511] = 0x55, 0xaa
+	}
+
+	sum := checksum(region, func(i int) bool { return i == 106 || i == 107 || i == 112 })
+	for _, base := range []int{0, 12} {
+		copy(img[base*sectsz:], region)
+		for i := 0; i < sectsz; i += 4 {
+			le.PutUint32(img[(base+11)*sectsz+i:], sum)
+		}
+	}
+}
+
+func entrySet(name string, attr uint16, first, size, valid int, nofat bool) []byte {
+	u := utf16.Encode([]rune(name))
+	nn := (len(u) + 14) / 15
+	e := make([]byte, 32*(2+nn))
+
+	// 2023-06-15 12:30:44 UTC-5
+	ts := uint32(2023-1980)<<25 | 6<<21 | 15<<16 | 12<<11 | 30<<5 | 44/2
+	e[0], e[1] = 0x85, uint8(1+nn)
+	le.PutUint16(e[4:], attr)
+	le.PutUint32(e[8:], ts)
+	le.PutUint32(e[12:], ts)
+	le.PutUint32(e[16:], ts)
+	e[20], e[21] = 150, 150
+	e[22], e[23], e[24] = 0x80|0x6c, 0x80|0x6c, 0x80|0x6c
+
+	s := e[32:]
+	s[0], s[1], s[3] = 0xc0, 1, uint8(len(u))
+	if nofat {
+		s[1] |= 2
+	}
+	le.PutUint64(s[8:], uint64(valid))
+	le.PutUint32(s[20:], uint32(first))
+	le.PutUint64(s[24:], uint64(size))
+
+	for i := 0; i < nn; i++ {
+		n := e[64+32*i:]
+		n[0] = 0xc1
+		for j := 0; j < 15 && i*15+j < len(u); j++ {
+			le.PutUint16(n[2+2*j:], u[i*15+j])
+		}
+	}
+
+	var sum uint16
+	for i, c := range e {
+		if i != 2 && i != 3 {
+			sum = sum<<15 | sum>>1 + uint16(c)
+		}
+	}
+	le.PutUint16(e[2:], sum)
+	return e
+}
+
+func checksum(b []byte, skip func(int) bool) uint32 {
+	var sum uint32
+	for i, c := range b {
+		if skip == nil || !skip(i) {
+			sum = sum<<31 | sum>>1 + uint32(c)
+		}
+	}
+	return sum
+}
+
+func setFAT(c int, v uint32) { le.PutUint32(img[fatoff*sectsz+c*4:], v) }
+
+func addr(c int) int { return (heapoff + (c-2)*spc) * sectsz }
+
+func seq(n int) []byte {
+	b := make([]byte, n)
+	for i := range b {
+		b[i] = byte(i)
+	}
+	return b
+}
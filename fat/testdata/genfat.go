@@ -0,0 +1,327 @@
+//go:build ignore
+
+// genfat writes the FAT12, FAT16 and FAT32 test images with the layout
+// mkfs.fat uses and fills them with a few files. It doesn't use the fat
+// package so the tests check it against an independent encoder.
+//
+//	go run genfat.go
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"log"
+	"os"
+	"strings"
+	"unicode/utf16"
+)
+
+const (
+	sectsz = 512
+
+	// 2020-01-02 03:04:06
+	date = (2020-1980)<<9 | 1<<5 | 2
+	tm   = 3<<11 | 4<<5 | 3
+)
+
+type image struct {
+	b       []byte
+	bits    int
+	spc     int
+	resv    int
+	nfats   int
+	rootent int
+	fatsz   int
+	rootsec int
+	data    int
+}
+
+var (
+	longData   = strings.Repeat("The quick brown fox jumps over the lazy dog.\n", 67)[:3000]
+	reportData = strings.Repeat("Quarterly numbers, all of them wrong.\n", 40)[:1500]
+)
+
+func main() {
+	log.SetFlags(0)
+	for _, c := range []struct {
+		name string
+		bits int
+		mb   int
+		spc  int
+	}{
+		{"fat12.img.gz", 12, 1, 1},
+		{"fat16.img.gz", 16, 16, 4},
+		{"fat32.img.gz", 32, 34, 1},
+	} {
+		m := newImage(c.bits, c.mb, c.spc)
+		m.fill()
+
+		var buf bytes.Buffer
+		w, _ := gzip.NewWriterLevel(&buf, gzip.BestCompression)
+		w.Write(m.b)
+		w.Close()
+		err := os.WriteFile(c.name, buf.Bytes(), 0644)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+}
+
+func newImage(bits, mb, spc int) *image {
+	m := &image{
+		b:       make([]byte, mb<<20),
+		bits:    bits,
+		spc:     spc,
+		resv:    1,
+		nfats:   2,
+		rootent: 512,
+	}
+	if bits == 12 {
+		m.rootent = 224
+	}
+	if bits == 32 {
+		m.resv, m.rootent = 32, 0
+	}
+	tot := len(m.b) / sectsz
+	m.rootsec = m.rootent * 32 / sectsz
+	for m.fatsz = 1; ; m.fatsz++ {
+		ncl := (tot - m.resv - m.nfats*m.fatsz - m.rootsec) / spc
+		if ((ncl+2)*bits+7)/8 <= m.fatsz*sectsz {
+			break
+		}
+	}
+	m.data = m.resv + m.nfats*m.fatsz + m.rootsec
+
+	b := m.b[:sectsz]
+	copy(b, "\xeb\x3c\x90mkfs.fat")
+	le := binary.LittleEndian
+	le.PutUint16(b[11:], sectsz)
+	b[13] = uint8(spc)
+	le.PutUint16(b[14:], uint16(m.resv))
+	b[16] = uint8(m.nfats)
+	le.PutUint16(b[17:], uint16(m.rootent))
+	if tot < 65536 {
+		le.PutUint16(b[19:], uint16(tot))
+	} else {
+		le.PutUint32(b[32:], uint32(tot))
+	}
+	b[21] = 0xf8
+	le.PutUint16(b[24:], 32)
+	le.PutUint16(b[26:], 64)
+	ext := b[36:]
+	if bits == 32 {
+		le.PutUint32(b[36:], uint32(m.fatsz))
+		le.PutUint32(b[44:], 2)
+		le.PutUint16(b[48:], 1)
+		le.PutUint16(b[50:], 6)
+		ext = b[64:]
+	} else {
+		le.PutUint16(b[22:], uint16(m.fatsz))
+	}
+	ext[0] = 0x80
+	ext[2] = 0x29
+	le.PutUint32(ext[3:], 0x1234abcd)
+	copy(ext[7:], "TESTVOL    ")
+	copy(ext[18:], "FAT     ")
+	b[510], b[511] = 0x55, 0xaa
+
+	if bits == 32 {
+		fi := m.b[sectsz : 2*sectsz]
+		le.PutUint32(fi[0:], 0x41615252)
+		le.PutUint32(fi[484:], 0x61417272)
+		le.PutUint32(fi[488:], 0xffffffff)
+		le.PutUint32(fi[492:], 0xffffffff)
+		fi[510], fi[511] = 0x55, 0xaa
+		copy(m.b[6*sectsz:], m.b[:2*sectsz])
+	}
+
+	m.setFAT(0, 0xffffff8)
+	m.setFAT(1, 0xfffffff)
+	return m
+}
+
+// fill lays out
+//
+//	/TESTVOL          volume label
+//	/README.TXT       cluster 3, ends with an all ones EOC marker
+//	/Long File Name.txt  fragmented chain starting at 10
+//	/FILE00.TXT ...   empty files so the FAT32 root needs a second cluster
+//	/SUB/INNER.TXT
+//
+// marks cluster 30 bad and leaves deleted entries behind
+//
+//	/Deleted Report.doc  contiguous from the free cluster 70
+//	/OLDNOTE.TXT         no long name, free cluster 80
+//	/Reused File.bin     its cluster 10 now belongs to the long file
+//	/SUB/zeta notes.txt  fragments with different checksums, cluster 90
+func (m *image) fill() {
+	var root []byte
+	root = append(root, entry("TESTVOL    ", 0x08, 0, 0)...)
+
+	root = append(root, entry("README  TXT", 0x20, 3, 13)...)
+	m.write(3, []byte("hello, world\n"))
+	m.setFAT(3, 0xfffffff)
+
+	cb := m.spc * sectsz
+	var chain []int
+	for _, c := range []int{10, 11, 12, 20, 21, 22}[:(len(longData)+cb-1)/cb] {
+		chain = append(chain, c)
+	}
+	m.chain(chain, 0xffffff8)
+	for i, c := range chain {
+		end := (i + 1) * cb
+		if end > len(longData) {
+			end = len(longData)
+		}
+		m.write(c, []byte(longData[i*cb:end]))
+	}
+	root = append(root, lfn("Long File Name.txt", "LONGFI~1TXT")...)
+	root = append(root, entry("LONGFI~1TXT", 0x20, 10, len(longData))...)
+
+	for i := 0; i < 18; i++ {
+		root = append(root, entry("FILE"+string(rune('0'+i/10))+string(rune('0'+i%10))+"  TXT", 0x20, 0, 0)...)
+	}
+
+	root = append(root, entry("SUB        ", 0x10, 5, 0)...)
+	var sub []byte
+	sub = append(sub, entry(".          ", 0x10, 5, 0)...)
+	sub = append(sub, entry("..         ", 0x10, 0, 0)...)
+	sub = append(sub, entry("INNER   TXT", 0x20, 6, 7)...)
+	m.write(5, sub)
+	m.setFAT(5, 0xfffffff)
+	m.write(6, []byte("inside\n"))
+	m.setFAT(6, 0xfffffff)
+
+	m.setFAT(30, 0xffffff7)
+
+	n := (len(reportData) + cb - 1) / cb
+	for i := 0; i < n; i++ {
+		end := (i + 1) * cb
+		if end > len(reportData) {
+			end = len(reportData)
+		}
+		m.write(70+i, []byte(reportData[i*cb:end]))
+	}
+	root = append(root, deleted(lfn("Deleted Report.doc", "DELETE~1DOC"))...)
+	root = append(root, deleted(entry("DELETE~1DOC", 0x20, 70, len(reportData)))...)
+
+	m.write(80, []byte("old note\n"))
+	root = append(root, deleted(entry("OLDNOTE TXT", 0x20, 80, 9))...)
+
+	root = append(root, deleted(lfn("Reused File.bin", "REUSED~1BIN"))...)
+	root = append(root, deleted(entry("REUSED~1BIN", 0x20, 10, 100))...)
+
+	z := lfn("zeta notes.txt", "ZETANO~1TXT")
+	z[13]++
+	sub = append(sub, deleted(z)...)
+	sub = append(sub, deleted(entry("ZETANO~1TXT", 0x20, 90, 5))...)
+	m.write(90, []byte("zeta\n"))
+	m.write(5, sub)
+
+	if m.bits != 32 {
+		copy(m.b[(m.resv+m.nfats*m.fatsz)*sectsz:], root)
+		return
+	}
+	cb = m.spc * sectsz
+	m.chain([]int{2, 40}, 0xffffff8)
+	m.write(2, root[:cb])
+	m.write(40, root[cb:])
+}
+
+func (m *image) setFAT(c, v int) {
+	for n := 0; n < m.nfats; n++ {
+		fat := m.b[(m.resv+n*m.fatsz)*sectsz:]
+		switch m.bits {
+		case 12:
+			v := uint16(v & 0xfff)
+			p := fat[c+c/2:]
+			x := binary.LittleEndian.Uint16(p)
+			if c&1 != 0 {
+				x = x&0xf | v<<4
+			} else {
+				x = x&0xf000 | v
+			}
+			binary.LittleEndian.PutUint16(p, x)
+		case 16:
+			binary.LittleEndian.PutUint16(fat[c*2:], uint16(v))
+		case 32:
+			// the all ones marker keeps its top bits to check they are masked
+			x := uint32(v)
+			if v == 0xfffffff {
+				x = 0xffffffff
+			}
+			binary.LittleEndian.PutUint32(fat[c*4:], x)
+		}
+	}
+}
+
+func (m *image) chain(cs []int, eoc int) {
+	for i, c := range cs {
+		if i+1 < len(cs) {
+			m.setFAT(c, cs[i+1])
+		} else {
+			m.setFAT(c, eoc)
+		}
+	}
+}
+
+func (m *image) write(c int, b []byte) {
+	copy(m.b[(m.data+(c-2)*m.spc)*sectsz:], b)
+}
+
+func entry(name string, attr uint8, cluster, size int) []byte {
+	b := make([]byte, 32)
+	copy(b, name)
+	b[11] = attr
+	le := binary.LittleEndian
+	le.PutUint16(b[14:], tm)
+	le.PutUint16(b[16:], date)
+	le.PutUint16(b[18:], date)
+	le.PutUint16(b[20:], uint16(cluster>>16))
+	le.PutUint16(b[22:], tm)
+	le.PutUint16(b[24:], date)
+	le.PutUint16(b[26:], uint16(cluster))
+	le.PutUint32(b[28:], uint32(size))
+	return b
+}
+
+// deleted marks every slot of the entries as deleted
+func deleted(b []byte) []byte {
+	for i := 0; i < len(b); i += 32 {
+		b[i] = 0xe5
+	}
+	return b
+}
+
+// lfn returns the long name entries for name in the order they are stored
+func lfn(name, short string) []byte {
+	var sum uint8
+	for i := 0; i < 11; i++ {
+		sum = (sum&1)<<7 + sum>>1 + short[i]
+	}
+
+	u := utf16.Encode([]rune(name))
+	n := (len(u) + 12) / 13
+	u = append(u, 0)
+	for len(u) < n*13 {
+		u = append(u, 0xffff)
+	}
+
+	var out []byte
+	for seq := n; seq >= 1; seq-- {
+		b := make([]byte, 32)
+		b[0] = uint8(seq)
+		if seq == n {
+			b[0] |= 0x40
+		}
+		b[11] = 0x0f
+		b[13] = sum
+		part := u[(seq-1)*13 : seq*13]
+		for i, off := range []int{1, 3, 5, 7, 9, 14, 16, 18, 20, 22, 24, 28, 30} {
+			binary.LittleEndian.PutUint16(b[off:], part[i])
+		}
+		out = append(out, b...)
+	}
+	return out
+}
@@ -0,0 +1,225 @@
+package fat
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"os"
+	stdpath "path"
+	"unicode/utf16"
+)
+
+// Deleted is a directory entry whose first byte was overwritten by 0xe5
+type Deleted struct {
+	Path     string  // best guess of the full path
+	Name     string  // long name if fragments survived, otherwise the short name
+	Short    string  // short name with the guessed first character
+	LFN      bool    // the name came from long name fragments
+	Exact    bool    // the first character was confirmed by the LFN checksum
+	Dir      Dir     // the entry as found, Name[0] is 0xe5
+	Clusters []int64 // probable contiguous run holding the data
+	Reused   bool    // some of the clusters are allocated again
+
+	fs *FileSystem
+}
+
+// Deleted lists the deleted entries of the directory name
+func (fs *FileSystem) Deleted(name string) ([]*Deleted, error) {
+	name = fs.abs(name)
+	dir, err := fs.walk(name)
+	if err != nil {
+		return nil, &os.PathError{Op: "deleted", Path: name, Err: err}
+	}
+	if !dir.IsDir() {
+		return nil, &os.PathError{Op: "deleted", Path: name, Err: ErrNotDir}
+	}
+
+	var (
+		ds   []*Deleted
+		frag []LFN
+		buf  [fatDirsz]byte
+	)
+	for pos := int64(0); ; pos += fatDirsz {
+		addr := dir.slotAddr(pos)
+		if addr < 0 {
+			break
+		}
+		_, err := fs.rw.ReadAt(buf[:], addr)
+		if err != nil {
+			return ds, err
+		}
+		if buf[0] == 0 {
+			break
+		}
+
+		bp := bytes.NewReader(buf[:])
+		switch {
+		case buf[0] != 0xe5:
+			frag = frag[:0]
+
+		case buf[11]&0x3f == 0xf:
+			var lfn LFN
+			binary.Read(bp, binary.LittleEndian, &lfn)
+			frag = append(frag, lfn)
+
+		default:
+			d := &Deleted{fs: fs}
+			binary.Read(bp, binary.LittleEndian, &d.Dir)
+			if d.Dir.Attr&VOLUME_LABEL == 0 {
+				d.recover(frag)
+				d.Path = stdpath.Join(name, d.Name)
+				err = d.locate()
+				if err != nil {
+					return ds, err
+				}
+				ds = append(ds, d)
+			}
+			frag = frag[:0]
+		}
+	}
+	return ds, nil
+}
+
+// recover rebuilds the names, the long name fragments are stored in
+// reverse order before the short entry and lost their sequence numbers
+func (d *Deleted) recover(frag []LFN) {
+	var short [11]byte
+	copy(short[:], d.Dir.Name[:])
+	copy(short[8:], d.Dir.Ext[:])
+
+	var units []uint16
+	for i := len(frag) - 1; i >= 0; i-- {
+		l := frag[i]
+		units = append(units, l.Name0[:]...)
+		units = append(units, l.Name1[:]...)
+		units = append(units, l.Name2[:]...)
+	}
+	for i, u := range units {
+		if u == 0 || u == 0xffff {
+			units = units[:i]
+			break
+		}
+	}
+	if len(units) > 0 {
+		d.Name = string(utf16.Decode(units))
+		d.LFN = true
+	}
+
+	// try every character against the checksum, fall back to the first
+	// letter of the long name or an underscore
+	short[0] = '_'
+	if len(frag) > 0 && sameChecksum(frag) {
+		for c := 0x21; c < 0x100; c++ {
+			short[0] = byte(c)
+			if LFNChecksum(short[:]) == frag[0].Checksum {
+				d.Exact = shortChar(byte(c))
+				break
+			}
+		}
+		if !d.Exact {
+			short[0] = '_'
+		}
+	}
+	if !d.Exact && d.LFN {
+		if c := []rune(d.Name)[0]; c < 0x80 && c > 0x20 {
+			short[0] = byte(c)
+			if 'a' <= c && c <= 'z' {
+				short[0] -= 'a' - 'A'
+			}
+		}
+	}
+
+	d.Dir.Name[0] = short[0]
+	d.Short = d.fs.shortName(&d.Dir)
+	d.Dir.Name[0] = 0xe5
+	if !d.LFN {
+		d.Name = d.Short
+	}
+}
+
+func sameChecksum(frag []LFN) bool {
+	for _, l := range frag {
+		if l.Checksum != frag[0].Checksum {
+			return false
+		}
+	}
+	return true
+}
+
+// the checksum maps every first byte to a different sum, so a match
+// is only believable if it is a character allowed in short names
+func shortChar(c byte) bool {
+	switch {
+	case 'A' <= c && c <= 'Z', '0' <= c && c <= '9', c >= 0x80 && c != 0xe5:
+		return true
+	}
+	return bytes.IndexByte([]byte("!#$%&'()-@^_`{}~"), c) >= 0
+}
+
+// locate assumes the file was stored contiguously from its start cluster,
+// which is the only thing left after the chain was freed
+func (d *Deleted) locate() error {
+	fs := d.fs
+	start := int64(d.Dir.Cluster)
+	if fs.fatbits == 32 {
+		start |= int64(d.Dir.Cluster32) << 16
+	}
+	if start < 2 || start > fs.maxCluster() {
+		return nil
+	}
+
+	cb := fs.clusterBytes()
+	n := (int64(d.Dir.Length) + cb - 1) / cb
+	if d.Dir.Attr&DIRECTORY != 0 {
+		n = 1
+	}
+	for c := start; c < start+n && c <= fs.maxCluster(); c++ {
+		v, err := fs.getFAT(c)
+		if err != nil {
+			return err
+		}
+		if v != 0 {
+			d.Reused = true
+		}
+		d.Clusters = append(d.Clusters, c)
+	}
+	return nil
+}
+
+// Extract copies the recovered data to w, the data is only trustworthy
+// if the clusters were not reused
+func (d *Deleted) Extract(w io.Writer) (int64, error) {
+	fs := d.fs
+	size := int64(d.Dir.Length)
+	cb := fs.clusterBytes()
+	if d.Dir.Attr&DIRECTORY != 0 {
+		size = cb * int64(len(d.Clusters))
+	}
+
+	buf := make([]byte, cb)
+	var n int64
+	for _, c := range d.Clusters {
+		m := cb
+		if m > size-n {
+			m = size - n
+		}
+		if m <= 0 {
+			break
+		}
+
+		_, err := fs.rw.ReadAt(buf[:m], fs.clusterAddr(c))
+		if err != nil {
+			return n, err
+		}
+		nw, err := w.Write(buf[:m])
+		n += int64(nw)
+		if err != nil {
+			return n, err
+		}
+	}
+
+	if n < size {
+		return n, io.ErrUnexpectedEOF
+	}
+	return n, nil
+}
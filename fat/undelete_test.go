@@ -0,0 +1,139 @@
+package fat
+
+import (
+	"bytes"
+	"io"
+	"testing"
+)
+
+var reportData = bytes.Repeat([]byte("Quarterly numbers, all of them wrong.\n"), 40)[:1500]
+
+func TestDeleted(t *testing.T) {
+	type want struct {
+		path   string
+		name   string
+		short  string
+		lfn    bool
+		exact  bool
+		start  int64
+		reused bool
+	}
+	tab := []struct {
+		dir  string
+		want []want
+	}{
+		{"/", []want{
+			{"/Deleted Report.doc", "Deleted Report.doc", "DELETE~1.DOC", true, true, 70, false},
+			{"/_LDNOTE.TXT", "_LDNOTE.TXT", "_LDNOTE.TXT", false, false, 80, false},
+			{"/Reused File.bin", "Reused File.bin", "REUSED~1.BIN", true, true, 10, true},
+		}},
+		{"/SUB", []want{
+			{"/SUB/zeta notes.txt", "zeta notes.txt", "ZETANO~1.TXT", true, false, 90, false},
+		}},
+	}
+
+	for _, bits := range []int{12, 16, 32} {
+		_, fs := openImage(t, bits)
+		for _, tt := range tab {
+			ds, err := fs.Deleted(tt.dir)
+			if err != nil {
+				t.Fatalf("FAT%d: %s: %v", bits, tt.dir, err)
+			}
+			if len(ds) != len(tt.want) {
+				t.Fatalf("FAT%d: %s: got %d entries, want %d", bits, tt.dir, len(ds), len(tt.want))
+			}
+			for i, w := range tt.want {
+				d := ds[i]
+				if d.Path != w.path || d.Name != w.name || d.Short != w.short {
+					t.Errorf("FAT%d: got %q %q %q, want %q %q %q", bits, d.Path, d.Name, d.Short, w.path, w.name, w.short)
+				}
+				if d.LFN != w.lfn || d.Exact != w.exact || d.Reused != w.reused {
+					t.Errorf("FAT%d: %s: lfn %v exact %v reused %v, want %v %v %v",
+						bits, w.path, d.LFN, d.Exact, d.Reused, w.lfn, w.exact, w.reused)
+				}
+				if len(d.Clusters) == 0 || d.Clusters[0] != w.start {
+					t.Errorf("FAT%d: %s: clusters %v, want a run from %d", bits, w.path, d.Clusters, w.start)
+				}
+			}
+		}
+	}
+}
+
+func TestDeletedExtract(t *testing.T) {
+	for _, bits := range []int{12, 16, 32} {
+		_, fs := openImage(t, bits)
+		ds, err := fs.Deleted("/")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		cb := fs.clusterBytes()
+		d := ds[0]
+		if n := (int64(len(reportData)) + cb - 1) / cb; int64(len(d.Clusters)) != n {
+			t.Errorf("FAT%d: %d clusters, want %d", bits, len(d.Clusters), n)
+		}
+		var buf bytes.Buffer
+		n, err := d.Extract(&buf)
+		if err != nil || n != int64(len(reportData)) || !bytes.Equal(buf.Bytes(), reportData) {
+			t.Errorf("FAT%d: extract: %d %v, contents match %v", bits, n, err, bytes.Equal(buf.Bytes(), reportData))
+		}
+
+		buf.Reset()
+		d = ds[1]
+		_, err = d.Extract(&buf)
+		if err != nil || buf.String() != "old note\n" {
+			t.Errorf("FAT%d: extract: %q %v", bits, buf.String(), err)
+		}
+
+		// nothing left to read, e.g. the start cluster was out of range
+		d.Clusters = nil
+		_, err = d.Extract(&buf)
+		if err != io.ErrUnexpectedEOF {
+			t.Errorf("FAT%d: extract without clusters: %v", bits, err)
+		}
+	}
+}
+
+func TestDeletedRemove(t *testing.T) {
+	_, fs := openImage(t, 16)
+	err := fs.Remove("/README.TXT")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ds, err := fs.Deleted("/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ds) != 4 || ds[0].Short != "_EADME.TXT" || ds[0].Exact || ds[0].Reused {
+		t.Fatalf("got %d entries, first %+v", len(ds), ds[0])
+	}
+	var buf bytes.Buffer
+	_, err = ds[0].Extract(&buf)
+	if err != nil || buf.String() != readmeData {
+		t.Errorf("extract: %q %v", buf.String(), err)
+	}
+
+	// the new file takes the lowest free clusters, which include the one
+	// README.TXT left behind
+	f, err := fs.Create("/SUB/NEW.TXT")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Write(make([]byte, 3*fs.clusterBytes()))
+	f.Close()
+	ds, err = fs.Deleted("/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ds[0].Short != "_EADME.TXT" || !ds[0].Reused {
+		t.Errorf("%s: cluster %v not reported as reused", ds[0].Short, ds[0].Clusters)
+	}
+	if ds[1].Reused {
+		t.Errorf("%s: cluster %v reported as reused", ds[1].Short, ds[1].Clusters)
+	}
+
+	_, err = fs.Deleted("/README.TXT")
+	if err == nil {
+		t.Error("deleted of a missing directory succeeded")
+	}
+}
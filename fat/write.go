@@ -0,0 +1,833 @@
+package fat
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"os"
+	stdpath "path"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf16"
+)
+
+var (
+	ErrNotEmpty = errors.New("directory not empty")
+	ErrNoSpace  = errors.New("no space left on device")
+	ErrDirFull  = errors.New("directory full")
+	ErrName     = errors.New("invalid file name")
+	ErrTooLarge = errors.New("file too large")
+)
+
+const (
+	fsinfoSig0    = 0x41615252
+	fsinfoSig1    = 0x61417272
+	maxFileLength = 0xffffffff
+)
+
+func (fs *FileSystem) clusterBytes() int64 {
+	return fs.clustersz * fs.sectsz
+}
+
+func (fs *FileSystem) clusterAddr(c int64) int64 {
+	return (fs.dataaddr + (c-2)*fs.clustersz) * fs.sectsz
+}
+
+func (fs *FileSystem) maxCluster() int64 {
+	return fs.nclusters + 1
+}
+
+func (fs *FileSystem) eoc() int64 {
+	switch fs.fatbits {
+	case 12:
+		return 0xfff
+	case 16:
+		return 0xffff
+	}
+	return 0xfffffff
+}
+
+func (fs *FileSystem) fatAddr(n, c int64) int64 {
+	return (fs.fataddr+n*fs.fatsz)*fs.sectsz + c*fs.fatbits/8
+}
+
+func (fs *FileSystem) isEOC(v int64) bool {
+	return v >= fs.eoc()&^7
+}
+
+func (fs *FileSystem) badCluster() int64 {
+	return fs.eoc() - 8
+}
+
+// getFAT reads the entry for cluster c from the first FAT
+func (fs *FileSystem) getFAT(c int64) (int64, error) {
+	return fs.readFAT(0, c)
+}
+
+func (fs *FileSystem) readFAT(n, c int64) (int64, error) {
+	var b [4]byte
+	addr := fs.fatAddr(n, c)
+	switch fs.fatbits {
+	case 12:
+		_, err := fs.rw.ReadAt(b[:2], addr)
+		v := int64(binary.LittleEndian.Uint16(b[:]))
+		if c&1 != 0 {
+			return v >> 4, err
+		}
+		return v & 0xfff, err
+	case 16:
+		_, err := fs.rw.ReadAt(b[:2], addr)
+		return int64(binary.LittleEndian.Uint16(b[:])), err
+	}
+	_, err := fs.rw.ReadAt(b[:], addr)
+	return int64(binary.LittleEndian.Uint32(b[:])) & 0xfffffff, err
+}
+
+// setFAT writes the entry for cluster c to every FAT copy
+func (fs *FileSystem) setFAT(c, v int64) error {
+	var b [4]byte
+	for i := int64(0); i < fs.nfats; i++ {
+		addr := fs.fatAddr(i, c)
+		var err error
+		switch fs.fatbits {
+		case 12:
+			_, err = fs.rw.ReadAt(b[:2], addr)
+			if err != nil {
+				return err
+			}
+			u := binary.LittleEndian.Uint16(b[:])
+			if c&1 != 0 {
+				u = u&0x000f | uint16(v)<<4
+			} else {
+				u = u&0xf000 | uint16(v)&0xfff
+			}
+			binary.LittleEndian.PutUint16(b[:], u)
+			_, err = fs.rw.WriteAt(b[:2], addr)
+		case 16:
+			binary.LittleEndian.PutUint16(b[:], uint16(v))
+			_, err = fs.rw.WriteAt(b[:2], addr)
+		case 32:
+			_, err = fs.rw.ReadAt(b[:], addr)
+			if err != nil {
+				return err
+			}
+			u := binary.LittleEndian.Uint32(b[:])
+			u = u&0xf0000000 | uint32(v)&0xfffffff
+			binary.LittleEndian.PutUint32(b[:], u)
+			_, err = fs.rw.WriteAt(b[:], addr)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// alloc finds a free cluster, marks it as the end of a chain and links it
+// after prev if prev is a valid cluster, the new cluster is zeroed
+func (fs *FileSystem) alloc(prev int64) (int64, error) {
+	max := fs.maxCluster()
+	start := fs.nextfree
+	if start < 2 || start > max {
+		start = 2
+	}
+
+	c := start
+	for {
+		v, err := fs.getFAT(c)
+		if err != nil {
+			return 0, err
+		}
+		if v == 0 {
+			break
+		}
+
+		c++
+		if c > max {
+			c = 2
+		}
+		if c == start {
+			return 0, ErrNoSpace
+		}
+	}
+
+	err := fs.zeroCluster(c)
+	if err != nil {
+		return 0, err
+	}
+	err = fs.setFAT(c, fs.eoc())
+	if err != nil {
+		return 0, err
+	}
+	if prev >= 2 {
+		err = fs.setFAT(prev, c)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	fs.nextfree = c + 1
+	return c, fs.adjustFree(-1)
+}
+
+func (fs *FileSystem) free(chain []int64) error {
+	for _, c := range chain {
+		err := fs.setFAT(c, 0)
+		if err != nil {
+			return err
+		}
+	}
+	if len(chain) > 0 && chain[0] < fs.nextfree {
+		fs.nextfree = chain[0]
+	}
+	return fs.adjustFree(int64(len(chain)))
+}
+
+func (fs *FileSystem) zeroCluster(c int64) error {
+	buf := make([]byte, fs.clusterBytes())
+	_, err := fs.rw.WriteAt(buf, fs.clusterAddr(c))
+	return err
+}
+
+func (fs *FileSystem) readInfo(addr int64) {
+	var buf [512]byte
+	_, err := fs.rw.ReadAt(buf[:], addr)
+	if err != nil {
+		return
+	}
+	if binary.LittleEndian.Uint32(buf[0:]) != fsinfoSig0 ||
+		binary.LittleEndian.Uint32(buf[484:]) != fsinfoSig1 {
+		return
+	}
+
+	fs.infoaddr = addr
+	fs.nfree = int64(binary.LittleEndian.Uint32(buf[488:]))
+	if fs.nfree > fs.nclusters {
+		fs.nfree = -1
+	}
+	if next := int64(binary.LittleEndian.Uint32(buf[492:])); next >= 2 && next <= fs.maxCluster() {
+		fs.nextfree = next
+	}
+}
+
+// adjustFree keeps the FAT32 FSInfo free count and next free hint current,
+// an unknown free count is left as is
+func (fs *FileSystem) adjustFree(delta int64) error {
+	if fs.infoaddr == 0 {
+		return nil
+	}
+
+	var buf [8]byte
+	nfree := uint32(0xffffffff)
+	if fs.nfree >= 0 {
+		fs.nfree += delta
+		nfree = uint32(fs.nfree)
+	}
+	binary.LittleEndian.PutUint32(buf[0:], nfree)
+	binary.LittleEndian.PutUint32(buf[4:], uint32(fs.nextfree))
+	_, err := fs.rw.WriteAt(buf[:], fs.infoaddr+488)
+	return err
+}
+
+func (f *File) writable() bool {
+	return f.flag&(os.O_WRONLY|os.O_RDWR) != 0
+}
+
+func (f *File) Write(b []byte) (int, error) {
+	if f.flag&os.O_APPEND != 0 {
+		f.off = int64(f.dir.Length)
+	}
+	n, err := f.WriteAt(b, f.off)
+	f.off += int64(n)
+	return n, err
+}
+
+func (f *File) WriteAt(b []byte, off int64) (int, error) {
+	if !f.writable() {
+		return 0, &os.PathError{Op: "write", Path: f.name, Err: os.ErrPermission}
+	}
+	if f.IsDir() {
+		return 0, &os.PathError{Op: "write", Path: f.name, Err: ErrIsDir}
+	}
+	if off < 0 {
+		return 0, &os.PathError{Op: "write", Path: f.name, Err: os.ErrInvalid}
+	}
+	if len(b) == 0 {
+		return 0, nil
+	}
+
+	end := off + int64(len(b))
+	if end > maxFileLength {
+		return 0, &os.PathError{Op: "write", Path: f.name, Err: ErrTooLarge}
+	}
+
+	size := int64(f.dir.Length)
+	if end > size {
+		err := f.grow(end)
+		if err != nil {
+			return 0, &os.PathError{Op: "write", Path: f.name, Err: err}
+		}
+	}
+
+	n, err := f.pwrite(b, off)
+	if end > size {
+		f.dir.Length = uint32(end)
+	}
+	f.touch()
+	if xerr := f.sync(); err == nil {
+		err = xerr
+	}
+	return n, err
+}
+
+func (f *File) Truncate(size int64) error {
+	if !f.writable() {
+		return &os.PathError{Op: "truncate", Path: f.name, Err: os.ErrPermission}
+	}
+	if f.IsDir() {
+		return &os.PathError{Op: "truncate", Path: f.name, Err: ErrIsDir}
+	}
+	if size < 0 || size > maxFileLength {
+		return &os.PathError{Op: "truncate", Path: f.name, Err: os.ErrInvalid}
+	}
+
+	err := f.grow(size)
+	if err == nil {
+		err = f.shrink(size)
+	}
+	if err != nil {
+		return &os.PathError{Op: "truncate", Path: f.name, Err: err}
+	}
+
+	f.dir.Length = uint32(size)
+	f.touch()
+	return f.sync()
+}
+
+// grow makes the chain big enough to hold size bytes and zeroes the
+// bytes between the current end of file and the end of its last cluster
+func (f *File) grow(size int64) error {
+	length := int64(f.dir.Length)
+	if size <= length {
+		return nil
+	}
+
+	cb := f.fs.clusterBytes()
+	err := f.extend((size + cb - 1) / cb)
+	if err != nil {
+		return err
+	}
+
+	if rem := length % cb; rem != 0 {
+		_, err = f.pwrite(make([]byte, cb-rem), length)
+	}
+	return err
+}
+
+func (f *File) shrink(size int64) error {
+	cb := f.fs.clusterBytes()
+	return f.cut((size + cb - 1) / cb)
+}
+
+// cut frees every cluster of the chain past the first keep
+func (f *File) cut(keep int64) error {
+	chain := f.chain()
+	if keep >= int64(len(chain)) {
+		return nil
+	}
+
+	var err error
+	if keep == 0 {
+		f.setStart(0)
+	} else {
+		err = f.fs.setFAT(chain[keep-1], f.fs.eoc())
+	}
+	if err == nil {
+		err = f.fs.free(chain[keep:])
+	}
+	for i := range f.clusters {
+		if int64(len(f.clusters[i])) > keep {
+			f.clusters[i] = f.clusters[i][:keep]
+		}
+	}
+	return err
+}
+
+// extend grows the cluster chain to n clusters, if that fails the
+// clusters it added are freed again so none are left unreferenced
+func (f *File) extend(n int64) error {
+	have := int64(len(f.chain()))
+	for int64(len(f.chain())) < n {
+		chain := f.chain()
+		prev := int64(0)
+		if len(chain) > 0 {
+			prev = chain[len(chain)-1]
+		}
+
+		c, err := f.fs.alloc(prev)
+		if err != nil {
+			f.cut(have)
+			return err
+		}
+		if prev == 0 {
+			f.setStart(c)
+		}
+		for i := range f.clusters {
+			f.clusters[i] = append(f.clusters[i], c)
+		}
+	}
+	return nil
+}
+
+func (f *File) chain() []int64 {
+	if len(f.clusters) == 0 {
+		return nil
+	}
+	return f.clusters[0]
+}
+
+func (f *File) setStart(c int64) {
+	f.dir.Cluster = uint16(c)
+	if f.fs.fatbits == 32 {
+		f.dir.Cluster32 = uint16(c >> 16)
+	}
+}
+
+// pwrite writes into clusters that are already allocated
+func (f *File) pwrite(b []byte, off int64) (int, error) {
+	cb := f.fs.clusterBytes()
+	n := 0
+	for n < len(b) {
+		addr := f.fileAddr(off/cb, off%cb)
+		if addr < 0 {
+			return n, ErrNoSpace
+		}
+
+		m := int64(len(b) - n)
+		if m > cb-off%cb {
+			m = cb - off%cb
+		}
+
+		nw, err := f.fs.rw.WriteAt(b[n:n+int(m)], addr)
+		n += nw
+		off += int64(nw)
+		if err != nil {
+			return n, err
+		}
+	}
+	return n, nil
+}
+
+func (f *File) touch() {
+	f.dir.Date, f.dir.Time = dosTime(f.fs.now())
+	f.dir.Adate = f.dir.Date
+}
+
+// sync writes the directory entry back, leaving the name untouched
+func (f *File) sync() error {
+	if f.root || f.dirstart == 0 {
+		return nil
+	}
+
+	buf := new(bytes.Buffer)
+	binary.Write(buf, binary.LittleEndian, &f.dir)
+	_, err := f.fs.rw.WriteAt(buf.Bytes()[11:], f.dirstart+11)
+	return err
+}
+
+func (fs *FileSystem) now() time.Time {
+	if fs.opt.Loc != nil {
+		return time.Now().In(fs.opt.Loc)
+	}
+	return time.Now()
+}
+
+// dosTime encodes t as a DOS date and time, clamped to 1980-2107
+func dosTime(t time.Time) (date, tm uint16) {
+	switch {
+	case t.Year() < 1980:
+		t = time.Date(1980, 1, 1, 0, 0, 0, 0, t.Location())
+	case t.Year() > 2107:
+		t = time.Date(2107, 12, 31, 23, 59, 58, 0, t.Location())
+	}
+	date = uint16(t.Year()-1980)<<9 | uint16(t.Month())<<5 | uint16(t.Day())
+	tm = uint16(t.Hour())<<11 | uint16(t.Minute())<<5 | uint16(t.Second()/2)
+	return
+}
+
+// create makes a new entry named name in the directory parent, directories
+// get their own cluster holding the dot entries
+func (fs *FileSystem) create(parent *File, name string, attr uint8) (*File, error) {
+	if !validName(name) {
+		return nil, ErrName
+	}
+	if _, err := parent.lookup(name); err == nil {
+		return nil, os.ErrExist
+	} else if err != os.ErrNotExist {
+		return nil, err
+	}
+
+	short, ncase, lfn, err := ShortAlias(name, fs.codepage(), parent.taken)
+	if err != nil {
+		return nil, err
+	}
+
+	var units []uint16
+	nslots := int64(1)
+	if lfn {
+		units = utf16.Encode([]rune(name))
+		nslots += int64(len(units)+12) / 13
+	}
+
+	pos, err := parent.findSlots(nslots)
+	if err != nil {
+		return nil, err
+	}
+
+	var dir Dir
+	copy(dir.Name[:], short[:8])
+	copy(dir.Ext[:], short[8:])
+	dir.Attr = attr
+	dir.Case = ncase
+	dir.Date, dir.Time = dosTime(fs.now())
+	dir.Cdate, dir.Ctime = dir.Date, dir.Time
+	dir.Adate = dir.Date
+
+	f := &File{
+		fs:       fs,
+		name:     name,
+		dir:      dir,
+		startpos: fs.dataaddr,
+	}
+	f.calcClusters()
+
+	if attr&DIRECTORY != 0 {
+		err = f.extend(1)
+		if err != nil {
+			return nil, err
+		}
+		err = f.writeDots(parent)
+		if err != nil {
+			fs.free(f.chain())
+			return nil, err
+		}
+	}
+
+	sum := LFNChecksum(short[:])
+	nlfn := nslots - 1
+	for i := int64(0); i < nlfn; i++ {
+		seq := nlfn - i
+		addr := parent.slotAddr(pos + i*fatDirsz)
+		f.lfnaddrs = append(f.lfnaddrs, addr)
+		err = fs.writeLFN(addr, units, seq, seq == nlfn, sum)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	f.dirstart = parent.slotAddr(pos + nlfn*fatDirsz)
+	buf := new(bytes.Buffer)
+	binary.Write(buf, binary.LittleEndian, &f.dir)
+	_, err = fs.rw.WriteAt(buf.Bytes(), f.dirstart)
+	if err != nil {
+		return nil, err
+	}
+
+	return f, nil
+}
+
+func (f *File) writeDots(parent *File) error {
+	up := int64(0)
+	if !parent.root {
+		up = int64(parent.dir.Cluster)
+		if f.fs.fatbits == 32 {
+			up |= int64(parent.dir.Cluster32) << 16
+		}
+	}
+
+	dot := f.dir
+	dot.Attr = DIRECTORY
+	copy(dot.Name[:], ".       ")
+	copy(dot.Ext[:], "   ")
+	dotdot := dot
+	dotdot.Name[1] = '.'
+	dotdot.Cluster = uint16(up)
+	dotdot.Cluster32 = uint16(up >> 16)
+
+	buf := new(bytes.Buffer)
+	binary.Write(buf, binary.LittleEndian, &dot)
+	binary.Write(buf, binary.LittleEndian, &dotdot)
+	_, err := f.fs.rw.WriteAt(buf.Bytes(), f.fileAddr(0, 0))
+	return err
+}
+
+func (fs *FileSystem) writeLFN(addr int64, units []uint16, seq int64, last bool, sum uint8) error {
+	var name [13]uint16
+	for i := range name {
+		j := (seq-1)*13 + int64(i)
+		switch {
+		case j < int64(len(units)):
+			name[i] = units[j]
+		case j == int64(len(units)):
+			name[i] = 0
+		default:
+			name[i] = 0xffff
+		}
+	}
+
+	lfn := LFN{
+		Seq:      uint8(seq),
+		Attr:     0xf,
+		Checksum: sum,
+	}
+	if last {
+		lfn.Seq |= 0x40
+	}
+	copy(lfn.Name0[:], name[0:5])
+	copy(lfn.Name1[:], name[5:11])
+	copy(lfn.Name2[:], name[11:13])
+
+	buf := new(bytes.Buffer)
+	binary.Write(buf, binary.LittleEndian, &lfn)
+	_, err := fs.rw.WriteAt(buf.Bytes(), addr)
+	return err
+}
+
+// findSlots returns the offset of n consecutive free slots in the directory,
+// growing it by a cluster when it runs out
+func (f *File) findSlots(n int64) (int64, error) {
+	var b [1]byte
+	start, run := int64(0), int64(0)
+	for pos := int64(0); ; pos += fatDirsz {
+		addr := f.slotAddr(pos)
+		if addr < 0 {
+			if f.root && f.fs.fatbits != 32 {
+				return 0, ErrDirFull
+			}
+			err := f.extend(int64(len(f.chain())) + 1)
+			if err != nil {
+				return 0, err
+			}
+			addr = f.slotAddr(pos)
+		}
+
+		_, err := f.fs.rw.ReadAt(b[:], addr)
+		if err != nil {
+			return 0, err
+		}
+		if b[0] != 0 && b[0] != 0xe5 {
+			run = 0
+			continue
+		}
+
+		if run == 0 {
+			start = pos
+		}
+		run++
+		if run == n {
+			return start, nil
+		}
+	}
+}
+
+func (fs *FileSystem) Remove(name string) error {
+	name = fs.abs(name)
+	f, err := fs.walk(name)
+	if err != nil {
+		return &os.PathError{Op: "remove", Path: name, Err: err}
+	}
+	if f.root {
+		return &os.PathError{Op: "remove", Path: name, Err: os.ErrPermission}
+	}
+
+	if f.IsDir() {
+		for pos := int64(0); ; {
+			e, next, err := f.next(pos)
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				return &os.PathError{Op: "remove", Path: name, Err: err}
+			}
+			if !e.dot() {
+				return &os.PathError{Op: "remove", Path: name, Err: ErrNotEmpty}
+			}
+			pos = next
+		}
+	}
+
+	for _, addr := range append(f.lfnaddrs, f.dirstart) {
+		_, err = fs.rw.WriteAt([]byte{0xe5}, addr)
+		if err != nil {
+			return err
+		}
+	}
+	return fs.free(f.chain())
+}
+
+func (fs *FileSystem) RemoveAll(name string) error {
+	name = fs.abs(name)
+	f, err := fs.walk(name)
+	if err == os.ErrNotExist {
+		return nil
+	}
+	if err != nil {
+		return &os.PathError{Op: "remove", Path: name, Err: err}
+	}
+
+	if f.IsDir() {
+		for pos := int64(0); ; {
+			e, next, err := f.next(pos)
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				return &os.PathError{Op: "remove", Path: name, Err: err}
+			}
+			if !e.dot() {
+				err = fs.RemoveAll(stdpath.Join(name, e.name))
+				if err != nil {
+					return err
+				}
+			}
+			pos = next
+		}
+	}
+
+	if f.root {
+		return nil
+	}
+	return fs.Remove(name)
+}
+
+func validName(name string) bool {
+	if name == "" || name == "." || name == ".." || len(utf16.Encode([]rune(name))) > 255 {
+		return false
+	}
+	for _, r := range name {
+		if r < 0x20 || strings.ContainsRune("\"*/:<>?\\|", r) {
+			return false
+		}
+	}
+	return true
+}
+
+// ShortAlias generates the 8.3 name stored for name. Leading dots are
+// dropped, the rest is upper cased and mapped to the codepage, characters
+// that are not allowed or missing from it become underscores and a numeric
+// tail NAME~N is added when anything was lost. Unlike Windows the tail keeps
+// counting past ~4 instead of switching to a hash of the long name. Names
+// that fit with an all lower case base or extension set the NT case flags in
+// ncase instead of needing long name entries. taken reports whether an alias
+// in NAME.EXT form is already used in the directory.
+func ShortAlias(name string, cp *Codepage, taken func(alias string) (bool, error)) (short [11]byte, ncase uint8, lfn bool, err error) {
+	for i := range short {
+		short[i] = ' '
+	}
+
+	trimmed := strings.TrimLeft(name, ".")
+	base, ext := trimmed, ""
+	if i := strings.LastIndex(trimmed, "."); i > 0 {
+		base, ext = trimmed[:i], trimmed[i+1:]
+	}
+
+	lossy := trimmed != name
+	b := shortChars(base, cp, &lossy)
+	e := shortChars(ext, cp, &lossy)
+	if len(b) > 8 || len(e) > 3 {
+		lossy = true
+	}
+	if len(b) == 0 {
+		b = []byte{'_'}
+	}
+	if len(e) > 3 {
+		e = e[:3]
+	}
+	copy(short[8:], e)
+
+	for i, s := range []string{base, ext} {
+		switch {
+		case s == strings.ToUpper(s):
+		case s == strings.ToLower(s):
+			ncase |= []uint8{LOWER_BASE, LOWER_EXT}[i]
+		default:
+			lfn = true
+		}
+	}
+	if lossy || lfn {
+		ncase, lfn = 0, true
+	}
+
+	alias := func() string {
+		s := strings.TrimRight(cp.Decode(short[:8]), " ")
+		if len(e) > 0 {
+			s += "." + cp.Decode(e)
+		}
+		return s
+	}
+
+	if !lossy {
+		copy(short[:], b)
+		used, err := taken(alias())
+		if err != nil || !used {
+			return escape(short), ncase, lfn, err
+		}
+		ncase, lfn = 0, true
+	}
+
+	for n := 1; n < 1000000; n++ {
+		tail := "~" + strconv.Itoa(n)
+		s := b
+		if len(s)+len(tail) > 8 {
+			s = s[:8-len(tail)]
+		}
+		copy(short[:8], string(s)+tail+"        ")
+
+		used, err := taken(alias())
+		if err != nil || !used {
+			return escape(short), ncase, lfn, err
+		}
+	}
+	return short, ncase, lfn, ErrDirFull
+}
+
+// escape stores a leading 0xe5 as 0x05 so it isn't taken for a deleted entry
+func escape(short [11]byte) [11]byte {
+	if short[0] == 0xe5 {
+		short[0] = 0x05
+	}
+	return short
+}
+
+// shortChars upper cases s into the codepage, some characters have no upper
+// case form in it so the original is tried too
+func shortChars(s string, cp *Codepage, lossy *bool) []byte {
+	var b []byte
+	for _, r := range s {
+		c, ok := cp.Encode(unicode.ToUpper(r))
+		if !ok {
+			c, ok = cp.Encode(r)
+		}
+		switch {
+		case r == ' ' || r == '.':
+			*lossy = true
+		case !ok || strings.ContainsRune("+,;=[]", r):
+			*lossy = true
+			b = append(b, '_')
+		default:
+			b = append(b, c)
+		}
+	}
+	return b
+}
+
+func (f *File) taken(alias string) (bool, error) {
+	_, err := f.lookup(alias)
+	if err == os.ErrNotExist {
+		return false, nil
+	}
+	return err == nil, err
+}
@@ -0,0 +1,83 @@
+package fat
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestShortAlias(t *testing.T) {
+	tests := []struct {
+		name  string
+		taken []string
+		short string
+		ncase uint8
+		lfn   bool
+	}{
+		{"README.TXT", nil, "README  TXT", 0, false},
+		{"readme.txt", nil, "README  TXT", LOWER_BASE | LOWER_EXT, false},
+		{"readme.TXT", nil, "README  TXT", LOWER_BASE, false},
+		{"Makefile", nil, "MAKEFILE   ", 0, true},
+		{"makefile", nil, "MAKEFILE   ", LOWER_BASE, false},
+		{"Mixed.txt", nil, "MIXED   TXT", 0, true},
+		{"café.txt", nil, "CAF\x90    TXT", LOWER_BASE | LOWER_EXT, false},
+		{".bashrc", nil, "BASHRC~1   ", 0, true},
+		{".bashrc", []string{"BASHRC~1"}, "BASHRC~2   ", 0, true},
+		{"...", nil, "_~1        ", 0, true},
+		{"long file name.txt", nil, "LONGFI~1TXT", 0, true},
+		{"x.tar.gz", nil, "XTAR~1  GZ ", 0, true},
+		{"a+b.c", nil, "A_B~1   C  ", 0, true},
+		{"archive.jpeg", nil, "ARCHIV~1JPE", 0, true},
+		{"readme.txt", []string{"README.TXT"}, "README~1TXT", 0, true},
+		{"€uro.txt", nil, "_URO~1  TXT", 0, true},
+		{"verylongname", []string{"VERYLO~1", "VERYLO~2", "VERYLO~3", "VERYLO~4", "VERYLO~5", "VERYLO~6", "VERYLO~7", "VERYLO~8", "VERYLO~9"}, "VERYL~10   ", 0, true},
+	}
+	for _, tt := range tests {
+		taken := func(alias string) (bool, error) {
+			for _, s := range tt.taken {
+				if s == alias {
+					return true, nil
+				}
+			}
+			return false, nil
+		}
+		short, ncase, lfn, err := ShortAlias(tt.name, &CP437, taken)
+		if err != nil {
+			t.Errorf("%q: %v", tt.name, err)
+			continue
+		}
+		if string(short[:]) != tt.short || ncase != tt.ncase || lfn != tt.lfn {
+			t.Errorf("%q: got %q %#x %v, want %q %#x %v", tt.name, short, ncase, lfn, tt.short, tt.ncase, tt.lfn)
+		}
+	}
+
+	_, _, _, err := ShortAlias("x", &CP437, func(string) (bool, error) { return false, fmt.Errorf("read error") })
+	if err == nil {
+		t.Error("error from taken was dropped")
+	}
+}
+
+func TestShortNameCase(t *testing.T) {
+	fs := &FileSystem{opt: &FileSystemOptions{}}
+	tests := []struct {
+		name, ext string
+		ncase     uint8
+		want      string
+	}{
+		{"README  ", "TXT", 0, "README.TXT"},
+		{"README  ", "TXT", LOWER_BASE, "readme.TXT"},
+		{"README  ", "TXT", LOWER_EXT, "README.txt"},
+		{"README  ", "TXT", LOWER_BASE | LOWER_EXT, "readme.txt"},
+		{"MAKEFILE", "   ", LOWER_BASE, "makefile"},
+		{"MAKEFILE", "   ", LOWER_EXT, "MAKEFILE"},
+		{"\x05BC     ", "   ", 0, "σBC"},
+	}
+	for _, tt := range tests {
+		var d Dir
+		copy(d.Name[:], tt.name)
+		copy(d.Ext[:], tt.ext)
+		d.Case = tt.ncase
+		if got := fs.shortName(&d); got != tt.want {
+			t.Errorf("%q.%q case %#x: got %q, want %q", tt.name, tt.ext, tt.ncase, got, tt.want)
+		}
+	}
+}
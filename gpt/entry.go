@@ -0,0 +1,90 @@
+package gpt
+
+import (
+	"errors"
+	"unicode/utf16"
+
+	"github.com/qeedquan/disktools/endian"
+)
+
+const (
+	AttrRequired   = 1 << 0
+	AttrNoBlockIO  = 1 << 1
+	AttrLegacyBoot = 1 << 2
+)
+
+// ChromeOS kernel partitions keep the A/B boot state in the type specific bits
+const (
+	chromeosPriorityShift   = 48
+	chromeosTriesShift      = 52
+	chromeosSuccessfulShift = 56
+)
+
+var (
+	ErrName = errors.New("gpt: name too long")
+)
+
+func (e *Entry) Empty() bool {
+	return e.Part == (GUID{})
+}
+
+func (e *Entry) Label() string {
+	var p []uint16
+	for i := 0; i+1 < len(e.Name); i += 2 {
+		c := endian.Read16le(e.Name[i:])
+		if c == 0 {
+			break
+		}
+		p = append(p, c)
+	}
+	return string(utf16.Decode(p))
+}
+
+func (e *Entry) setName(name string) error {
+	p := utf16.Encode([]rune(name))
+	if len(p)*2 > len(e.Name) {
+		return ErrName
+	}
+	e.Name = [72]byte{}
+	for i, c := range p {
+		endian.Put16le(e.Name[2*i:], c)
+	}
+	return nil
+}
+
+func (e *Entry) Size() uint64 {
+	if e.Empty() || e.Last < e.First {
+		return 0
+	}
+	return e.Last - e.First + 1
+}
+
+func (e *Entry) Required() bool       { return e.Attr&AttrRequired != 0 }
+func (e *Entry) NoBlockIO() bool      { return e.Attr&AttrNoBlockIO != 0 }
+func (e *Entry) LegacyBootable() bool { return e.Attr&AttrLegacyBoot != 0 }
+
+func (e *Entry) Priority() int    { return int(e.Attr>>chromeosPriorityShift) & 0xf }
+func (e *Entry) Tries() int       { return int(e.Attr>>chromeosTriesShift) & 0xf }
+func (e *Entry) Successful() bool { return e.Attr>>chromeosSuccessfulShift&1 != 0 }
+
+func (e *Entry) IsChromeOSKernel() bool {
+	name, _, _ := FindPart(e.Part)
+	return name == "chromeoskern"
+}
+
+func (e *Entry) TypeName() string {
+	_, desc, ok := FindPart(e.Part)
+	if !ok {
+		return "Unknown"
+	}
+	return desc
+}
+
+func FindPart(guid GUID) (name, desc string, ok bool) {
+	for _, p := range Parts {
+		if p.GUID == guid {
+			return p.Name, p.Desc, true
+		}
+	}
+	return "", "", false
+}
@@ -0,0 +1,83 @@
+package gpt
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestAttrBits(t *testing.T) {
+	tests := []struct {
+		attr                            uint64
+		required, noblockio, legacyboot bool
+	}{
+		{0, false, false, false},
+		{1, true, false, false},
+		{2, false, true, false},
+		{4, false, false, true},
+		{7, true, true, true},
+		{^uint64(7), false, false, false},
+	}
+	for _, tt := range tests {
+		e := Entry{Attr: tt.attr}
+		if e.Required() != tt.required || e.NoBlockIO() != tt.noblockio || e.LegacyBootable() != tt.legacyboot {
+			t.Errorf("%#x: required %v noblockio %v legacy boot %v", tt.attr, e.Required(), e.NoBlockIO(), e.LegacyBootable())
+		}
+	}
+}
+
+// the ChromeOS layout is priority in bits 48-51, tries in 52-55 and
+// successful in bit 56
+func TestChromeOSBits(t *testing.T) {
+	const mask = 0x1ff << 48
+	for _, rest := range []uint64{0, ^uint64(mask)} {
+		for prio := 0; prio < 16; prio++ {
+			for tries := 0; tries < 16; tries++ {
+				for _, ok := range []bool{false, true} {
+					attr := rest | uint64(prio)<<48 | uint64(tries)<<52
+					if ok {
+						attr |= 1 << 56
+					}
+					e := Entry{Attr: attr}
+					if e.Priority() != prio || e.Tries() != tries || e.Successful() != ok {
+						t.Fatalf("%#x: priority %d tries %d successful %v, want %d %d %v",
+							attr, e.Priority(), e.Tries(), e.Successful(), prio, tries, ok)
+					}
+				}
+			}
+		}
+	}
+
+	e := Entry{Part: MustParseGUID("FE3A2A5D-4F32-41A7-B725-ACCC3285A309")}
+	if !e.IsChromeOSKernel() {
+		t.Error("ChromeOS kernel type not recognized")
+	}
+	if e = (Entry{Part: efiSystem}); e.IsChromeOSKernel() {
+		t.Error("EFI system partition taken for a ChromeOS kernel")
+	}
+}
+
+func TestName(t *testing.T) {
+	for _, name := range []string{"", "EFI system partition", "Données", "𝄞 music", strings.Repeat("x", 36)} {
+		var e Entry
+		err := e.setName(name)
+		if err != nil {
+			t.Errorf("%q: %v", name, err)
+			continue
+		}
+		if got := e.Label(); got != name {
+			t.Errorf("%q: read back %q", name, got)
+		}
+	}
+
+	var e Entry
+	e.setName("old name")
+	if err := e.setName(strings.Repeat("x", 37)); err != ErrName {
+		t.Errorf("37 characters: got %v, want %v", err, ErrName)
+	}
+	if err := e.setName(strings.Repeat("𝄞", 19)); err != ErrName {
+		t.Errorf("19 surrogate pairs: got %v, want %v", err, ErrName)
+	}
+	if got := e.Label(); got != "old name" {
+		t.Errorf("failed rename changed the name to %q", got)
+	}
+}
@@ -4,19 +4,21 @@ import (
 	"bytes"
 	"encoding/binary"
 	"errors"
-	"fmt"
 	"io"
 	"math"
 
-	"github.com/qeedquan/disktools/endian"
+	"github.com/qeedquan/disktools/guid"
 	"github.com/qeedquan/disktools/mbr"
 )
 
+// a zero Sectsz probes the disk for the sector size the header was written with,
+// a zero Size queries the reader for the size of the disk when it is needed
 type Option struct {
 	Sectsz int
+	Size   int64
 }
 
-type GUID [16]byte
+type GUID = guid.GUID
 
 type Header struct {
 	Sig     [8]byte
@@ -49,30 +51,75 @@ type Table struct {
 	Header  Header
 	Sectsz  int
 	Entries []Entry
+
+	// Extra holds the bytes of each entry past the 128 decoded into
+	// Entry when the header has a larger Entsz, Write keeps them
+	Extra [][]byte
 }
 
 var (
-	ErrHeader = errors.New("gpt: invalid header")
+	ErrHeader    = errors.New("gpt: invalid header")
+	ErrEntrySize = errors.New("gpt: invalid partition entry size")
+	ErrTableSize = errors.New("gpt: partition entry array too large")
+	ErrTruncated = errors.New("gpt: partition entry array truncated")
+	ErrBounds    = errors.New("gpt: header LBA out of bounds")
+)
+
+// the spec only requires room for 128 entries, this leaves plenty
+// of headroom while stopping hostile images from exhausting memory
+const maxTableSize = 4 << 20
+
+const (
+	minSectsz = 512
+	maxSectsz = 64 << 10
 )
 
 func Open(r io.ReaderAt, o *Option) (*Table, error) {
 	if o == nil {
-		o = &Option{Sectsz: 512}
+		o = &Option{}
+	}
+
+	var err error
+	sectsz := o.Sectsz
+	if sectsz == 0 {
+		sectsz, err = DetectSectsz(r)
+		if err != nil {
+			return nil, err
+		}
 	}
+
 	d := decoder{
 		r:     r,
-		Table: Table{Sectsz: o.Sectsz},
+		size:  diskSize(r, o),
+		Table: Table{Sectsz: sectsz},
 	}
-	err := d.decode()
+	err = d.decode()
 	if err != nil {
 		return nil, err
 	}
 	return &d.Table, nil
 }
 
+// the primary header is always at LBA 1, so look for its signature
+// at every plausible sector size
+func DetectSectsz(r io.ReaderAt) (int, error) {
+	var sig [8]byte
+	for sectsz := minSectsz; sectsz <= maxSectsz; sectsz <<= 1 {
+		_, err := r.ReadAt(sig[:], int64(sectsz))
+		if err != nil {
+			break
+		}
+		if string(sig[:]) == "EFI PART" {
+			return sectsz, nil
+		}
+	}
+	return 0, ErrHeader
+}
+
 type decoder struct {
 	Table
-	r io.ReaderAt
+	r    io.ReaderAt
+	size int64
 }
 
 func (d *decoder) decode() error {
@@ -83,7 +130,7 @@ func (d *decoder) decode() error {
 		return err
 	}
 
-	if d.MBR.Part[0].Type != 0xee {
+	if ClassifyMBR(d.MBR) == LegacyMBR {
 		return ErrHeader
 	}
 
@@ -91,8 +138,12 @@ func (d *decoder) decode() error {
 	if err != nil {
 		return err
 	}
+	lim := lbaLimit(int64(d.Sectsz), d.size)
+	if d.Header.First >= lim || d.Header.Last >= lim {
+		return ErrBounds
+	}
 
-	d.Entries, err = d.readEntry(int64(d.Sectsz * 2))
+	d.Entries, err = d.readEntries()
 	if err != nil {
 		return err
 	}
@@ -115,66 +166,83 @@ func (d *decoder) readHeader(off int64) (Header, error) {
 	return h, nil
 }
 
-func (d *decoder) readEntry(off int64) ([]Entry, error) {
-	var entries []Entry
-
-	h := &d.Header
-	buf := make([]byte, h.Ent)
-	for i := uint32(0); i < h.Ent; i++ {
-		_, err := d.r.ReadAt(buf, off)
-		if err != nil {
-			return nil, err
-		}
-
-		var entry Entry
-		rd := bytes.NewReader(buf)
-		err = binary.Read(rd, binary.LittleEndian, &entry)
-		entries = append(entries, entry)
+func (d *decoder) readEntries() ([]Entry, error) {
+	buf, err := readTable(d.r, int64(d.Sectsz), d.size, &d.Header)
+	if err != nil {
+		return nil, err
 	}
+	d.Extra = decodeExtra(buf, d.Header.Ent, d.Header.Entsz)
+	return decodeEntries(buf, d.Header.Ent, d.Header.Entsz), nil
+}
 
-	return entries, nil
+// lbaLimit is the first LBA past the end of a disk of size bytes, or past
+// the largest byte offset an int64 holds if the size isn't known
+func lbaLimit(sectsz, size int64) uint64 {
+	if size > 0 {
+		return uint64(size / sectsz)
+	}
+	return uint64(math.MaxInt64 / sectsz)
 }
 
-func ParseGUID(guid string) ([16]byte, error) {
-	var (
-		a       uint32
-		b, c, d uint16
-		e       uint64
-		p       [16]byte
-	)
-	n, err := fmt.Sscanf(guid, "%x-%x-%x-%x-%x", &a, &b, &c, &d, &e)
-	if err != nil {
-		return p, err
+// entries can be larger than the 128 bytes we decode, the rest is reserved,
+// disksz is used to check the array lies on the disk if it is not 0
+func readTable(r io.ReaderAt, sectsz, disksz int64, h *Header) ([]byte, error) {
+	if h.Entsz < 128 || h.Entsz%8 != 0 {
+		return nil, ErrEntrySize
 	}
-	if n != 5 {
-		return p, errors.New("invalid GUID format")
+	size := int64(h.Ent) * int64(h.Entsz)
+	if size > maxTableSize {
+		return nil, ErrTableSize
 	}
 
-	endian.Put32le(p[0:], a)
-	endian.Put16le(p[4:], b)
-	endian.Put16le(p[6:], c)
-	endian.Put16le(p[8:], d)
-	endian.Put48le(p[10:], e)
+	// the array can't overlap the MBR or the primary header
+	lim := lbaLimit(sectsz, disksz)
+	if h.Table < 2 || h.Table >= lim {
+		return nil, ErrBounds
+	}
+	if h.Table+uint64((size+sectsz-1)/sectsz) > lim {
+		return nil, ErrTruncated
+	}
+
+	buf := make([]byte, size)
+	_, err := r.ReadAt(buf, int64(h.Table)*sectsz)
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		return nil, ErrTruncated
+	}
+	if err != nil {
+		return nil, err
+	}
+	return buf, nil
+}
 
-	return p, nil
+func decodeEntries(buf []byte, n, sz uint32) []Entry {
+	entries := make([]Entry, 0, n)
+	for i := uint32(0); i < n; i++ {
+		var entry Entry
+		rd := bytes.NewReader(buf[i*sz : i*sz+sz])
+		binary.Read(rd, binary.LittleEndian, &entry)
+		entries = append(entries, entry)
+	}
+	return entries
 }
 
-func MustParseGUID(guid string) GUID {
-	p, err := ParseGUID(guid)
-	if err != nil {
-		panic(err)
+func decodeExtra(buf []byte, n, sz uint32) [][]byte {
+	if sz <= entrySize {
+		return nil
+	}
+	extra := make([][]byte, 0, n)
+	for i := uint32(0); i < n; i++ {
+		extra = append(extra, append([]byte{}, buf[i*sz+entrySize:i*sz+sz]...))
 	}
-	return p
+	return extra
+}
+
+func ParseGUID(s string) (GUID, error) {
+	return guid.Parse(s)
 }
 
-func (p GUID) String() string {
-	return fmt.Sprintf("%X-%X-%X-%X-%X",
-		endian.Read32be(p[0:]),
-		endian.Read32be(p[4:]),
-		endian.Read32be(p[6:]),
-		endian.Read32be(p[8:]),
-		endian.Read48be(p[10:]),
-	)
+func MustParseGUID(s string) GUID {
+	return guid.MustParse(s)
 }
 
 var Parts = []struct {
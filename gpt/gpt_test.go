@@ -0,0 +1,95 @@
+package gpt
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"testing"
+)
+
+// patchHeader rewrites the primary header of d through f and fixes up its CRC
+func patchHeader(t *testing.T, d disk, f func(h *Header)) {
+	var h Header
+	err := binary.Read(bytes.NewReader(d[512:]), binary.LittleEndian, &h)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f(&h)
+	h.Hdrcrc = h.checksum()
+	copy(d[512:], h.encode())
+}
+
+func TestOpenBounds(t *testing.T) {
+	tests := []struct {
+		name string
+		f    func(h *Header)
+		err  error
+	}{
+		{"table wraps", func(h *Header) { h.Table = 1 << 62 }, ErrBounds},
+		{"table on the MBR", func(h *Header) { h.Table = 0 }, ErrBounds},
+		{"table past the end", func(h *Header) { h.Table = 4000 }, ErrBounds},
+		{"table runs off the end", func(h *Header) { h.Table = 2040 }, ErrTruncated},
+		{"last wraps", func(h *Header) { h.Last = 1 << 62 }, ErrBounds},
+		{"first past the end", func(h *Header) { h.First = 3000 }, ErrBounds},
+		{"4MiB", func(h *Header) { h.Ent = 32768 }, ErrTruncated},
+		{"over 4MiB", func(h *Header) { h.Ent = 32769 }, ErrTableSize},
+		{"huge entry", func(h *Header) { h.Ent, h.Entsz = 1, 4<<20+8 }, ErrTableSize},
+		{"short entry", func(h *Header) { h.Entsz = 64 }, ErrEntrySize},
+		{"unaligned entry", func(h *Header) { h.Entsz = 132 }, ErrEntrySize},
+	}
+	for _, tt := range tests {
+		d, _ := newDisk(t, 1<<20)
+		patchHeader(t, d, tt.f)
+		_, err := Open(d, &Option{Sectsz: 512})
+		if err != tt.err {
+			t.Errorf("%s: got %v, want %v", tt.name, err, tt.err)
+		}
+	}
+
+	// without a size only offsets that overflow are caught up front,
+	// the rest shows up as a short read
+	d, _ := newDisk(t, 1<<20)
+	patchHeader(t, d, func(h *Header) { h.Table = 1 << 62 })
+	if _, err := Open(struct{ io.ReaderAt }{d}, &Option{Sectsz: 512}); err != ErrBounds {
+		t.Errorf("unsized table wraps: got %v, want %v", err, ErrBounds)
+	}
+	patchHeader(t, d, func(h *Header) { h.Table = 4000 })
+	if _, err := Open(struct{ io.ReaderAt }{d}, &Option{Sectsz: 512}); err != ErrTruncated {
+		t.Errorf("unsized table past the end: got %v, want %v", err, ErrTruncated)
+	}
+}
+
+func TestOpenEntsz(t *testing.T) {
+	d, tab := newDisk(t, 1<<20)
+	tab.Header.Entsz = 512
+	tab.Header.Ent = 32
+	tab.Entries = tab.Entries[:32]
+	_, err := tab.Add(Entry{Part: efiSystem, First: tab.Header.First + 100, Last: tab.Header.First + 199})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tab.Extra = make([][]byte, 32)
+	for i := range tab.Extra {
+		tab.Extra[i] = bytes.Repeat([]byte{byte(i + 1)}, 384)
+	}
+	err = tab.Write(d)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rt, err := Open(d, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rt.Entries) != 32 || len(rt.Extra) != 32 {
+		t.Fatalf("decoded %d entries and %d extras", len(rt.Entries), len(rt.Extra))
+	}
+	for i := range rt.Entries {
+		if rt.Entries[i] != tab.Entries[i] {
+			t.Errorf("entry %d = %+v, want %+v", i, rt.Entries[i], tab.Entries[i])
+		}
+		if !bytes.Equal(rt.Extra[i], tab.Extra[i]) {
+			t.Errorf("entry %d: extra bytes not kept", i)
+		}
+	}
+}
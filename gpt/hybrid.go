@@ -0,0 +1,128 @@
+package gpt
+
+import (
+	"fmt"
+
+	"github.com/qeedquan/disktools/mbr"
+)
+
+type MBRKind int
+
+const (
+	LegacyMBR MBRKind = iota
+	ProtectiveMBR
+	HybridMBR
+)
+
+// Entry is the index of the GPT entry covering the same sectors
+// as the MBR slot, or -1 if there is none
+type HybridSlot struct {
+	Slot  int
+	Entry int
+}
+
+type HybridMap struct {
+	Kind     MBRKind
+	Slots    []HybridSlot
+	Warnings []string
+}
+
+func (k MBRKind) String() string {
+	switch k {
+	case LegacyMBR:
+		return "legacy"
+	case ProtectiveMBR:
+		return "protective"
+	case HybridMBR:
+		return "hybrid"
+	}
+	return fmt.Sprintf("MBRKind(%d)", int(k))
+}
+
+// a protective MBR only has 0xee slots, a hybrid MBR has
+// a 0xee slot alongside real partitions mirroring GPT entries
+func ClassifyMBR(m *mbr.Record) MBRKind {
+	prot, other := 0, 0
+	for i := range m.Part {
+		p := &m.Part[i]
+		switch {
+		case p.Empty():
+		case p.Type == 0xee:
+			prot++
+		default:
+			other++
+		}
+	}
+	switch {
+	case prot == 0:
+		return LegacyMBR
+	case other == 0:
+		return ProtectiveMBR
+	}
+	return HybridMBR
+}
+
+func (t *Table) Hybrid() *HybridMap {
+	h := &HybridMap{Kind: LegacyMBR}
+	if t.MBR == nil {
+		return h
+	}
+	h.Kind = ClassifyMBR(t.MBR)
+
+	warn := func(format string, args ...interface{}) {
+		h.Warnings = append(h.Warnings, fmt.Sprintf(format, args...))
+	}
+
+	var prot []*mbr.Part
+	for i := range t.MBR.Part {
+		p := &t.MBR.Part[i]
+		if p.Type != 0xee {
+			continue
+		}
+		prot = append(prot, p)
+		if p.FirstLBA != 1 {
+			warn("protective slot %d starts at LBA %d instead of 1", i+1, p.FirstLBA)
+		}
+	}
+	if h.Kind != HybridMBR {
+		return h
+	}
+
+	for i := range t.MBR.Part {
+		p := &t.MBR.Part[i]
+		if p.Empty() || p.Type == 0xee {
+			continue
+		}
+
+		s := HybridSlot{Slot: i, Entry: -1}
+		first, last := uint64(p.FirstLBA), p.LastLBA
+		overlap := false
+		for j := range t.Entries {
+			e := &t.Entries[j]
+			if e.Empty() {
+				continue
+			}
+			if e.First == first && e.Last == last {
+				s.Entry = j
+				break
+			}
+			if first <= e.Last && e.First <= last {
+				overlap = true
+				warn("slot %d (%d-%d) does not match GPT entry %d (%d-%d)",
+					i+1, first, last, j+1, e.First, e.Last)
+			}
+		}
+		if s.Entry < 0 && !overlap {
+			warn("slot %d (%d-%d) has no matching GPT entry", i+1, first, last)
+		}
+		for _, q := range prot {
+			if first <= q.LastLBA && uint64(q.FirstLBA) <= last {
+				warn("slot %d (%d-%d) overlaps the protective partition (%d-%d)",
+					i+1, first, last, q.FirstLBA, q.LastLBA)
+			}
+		}
+		h.Slots = append(h.Slots, s)
+	}
+
+	return h
+}
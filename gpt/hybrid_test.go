@@ -0,0 +1,92 @@
+package gpt
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/qeedquan/disktools/mbr"
+)
+
+func part(typ uint8, first, n uint32) mbr.Part {
+	return mbr.Part{Type: typ, FirstLBA: first, NumSectors: n, LastLBA: uint64(first) + uint64(n) - 1}
+}
+
+func TestClassifyMBR(t *testing.T) {
+	tests := []struct {
+		name  string
+		parts []mbr.Part
+		want  MBRKind
+	}{
+		{"empty", nil, LegacyMBR},
+		{"legacy", []mbr.Part{part(0x83, 2048, 1000)}, LegacyMBR},
+		{"protective", []mbr.Part{part(0xee, 1, 2047)}, ProtectiveMBR},
+		{"protective not first", []mbr.Part{{}, {}, part(0xee, 1, 2047)}, ProtectiveMBR},
+		{"hybrid", []mbr.Part{part(0xee, 1, 100), part(0x0c, 200, 100)}, HybridMBR},
+		{"hybrid protective last", []mbr.Part{part(0x0c, 200, 100), {}, {}, part(0xee, 1, 100)}, HybridMBR},
+	}
+	for _, tt := range tests {
+		m := &mbr.Record{Part: make([]mbr.Part, 4)}
+		copy(m.Part, tt.parts)
+		if got := ClassifyMBR(m); got != tt.want {
+			t.Errorf("%s: got %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestHybrid(t *testing.T) {
+	d, tab := newDisk(t, 1<<20)
+	first := tab.Header.First
+	_, err := tab.Add(Entry{Part: efiSystem, First: first + 100, Last: first + 199})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// slot 1 mirrors entry 2, slot 2 covers nothing, slot 3 half
+	// overlaps entry 1 and the protective slot starts off LBA 1
+	tab.MBR = &mbr.Record{Sectsz: 512, Part: []mbr.Part{
+		part(0xee, 2, 33),
+		part(0x0c, uint32(first+100), 100),
+		part(0x83, 1500, 10),
+		part(0x07, 30, 20),
+	}}
+	err = tab.Write(d)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rt, err := Open(d, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := rt.Hybrid()
+	if h.Kind != HybridMBR {
+		t.Fatalf("kind %v, want %v", h.Kind, HybridMBR)
+	}
+	want := []HybridSlot{{1, 1}, {2, -1}, {3, -1}}
+	if !reflect.DeepEqual(h.Slots, want) {
+		t.Errorf("slots %v, want %v", h.Slots, want)
+	}
+	warnings := []string{
+		"protective slot 1 starts at LBA 2 instead of 1",
+		"slot 3 (1500-1509) has no matching GPT entry",
+		"slot 4 (30-49) does not match GPT entry 1 (34-133)",
+		"slot 4 (30-49) overlaps the protective partition (2-34)",
+	}
+	if !reflect.DeepEqual(h.Warnings, warnings) {
+		t.Errorf("warnings %q, want %q", h.Warnings, warnings)
+	}
+
+	d, tab = newDisk(t, 1<<20)
+	rt, err = Open(d, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if h := rt.Hybrid(); h.Kind != ProtectiveMBR || len(h.Slots) != 0 || len(h.Warnings) != 0 {
+		t.Errorf("protective: %+v", h)
+	}
+
+	tab.MBR = nil
+	if h := tab.Hybrid(); h.Kind != LegacyMBR {
+		t.Errorf("no MBR: %+v", h)
+	}
+}
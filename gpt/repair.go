@@ -0,0 +1,172 @@
+package gpt
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/qeedquan/disktools/mbr"
+)
+
+type ReadWriterAt interface {
+	io.ReaderAt
+	io.WriterAt
+}
+
+var (
+	ErrUnrepairable = errors.New("gpt: both copies of the table are corrupt")
+)
+
+// Repair rebuilds a corrupt copy of the table from the intact one and moves
+// the backup to the last sector of the disk if the disk was resized,
+// extending the last usable LBA to match. Nothing is written if the table
+// is already consistent. It returns a finding for each change made, the
+// kind names the problem that was fixed. A relocated backup header has
+// its old copy zeroed so it can't be mistaken for the real one.
+func Repair(rw ReadWriterAt, o *Option) ([]Finding, error) {
+	sectsz, pri, bak, err := readCopies(rw, o)
+	if err != nil {
+		return nil, err
+	}
+
+	var changes []Finding
+	change := func(k Kind, ent int, format string, args ...interface{}) {
+		changes = append(changes, Finding{
+			Kind:  k,
+			Entry: ent,
+			Other: -1,
+			Desc:  fmt.Sprintf(format, args...),
+		})
+	}
+
+	var good *copyState
+	switch {
+	case pri.ok:
+		good = pri
+		if bak == nil || !bak.ok {
+			change(BackupCorrupt, -1, "rebuilt backup header and entry array from primary")
+		} else if !bytes.Equal(pri.table, bak.table) || !pri.header.mirrors(&bak.header) {
+			change(Mismatch, -1, "rewrote backup header and entry array to match primary")
+		}
+	case bak != nil && bak.ok:
+		good = bak
+		change(PrimaryCorrupt, -1, "rebuilt primary header and entry array from backup")
+	default:
+		return nil, ErrUnrepairable
+	}
+
+	h := good.header
+	tabsect := (uint64(h.Ent)*uint64(h.Entsz) + uint64(sectsz) - 1) / uint64(sectsz)
+	if good == bak {
+		h.Current, h.Backup = h.Backup, h.Current
+		h.Table = 2
+	}
+
+	t := &Table{
+		Header:  h,
+		Sectsz:  int(sectsz),
+		Entries: decodeEntries(good.table, h.Ent, h.Entsz),
+		Extra:   decodeExtra(good.table, h.Ent, h.Entsz),
+	}
+
+	if size := diskSize(rw, o); size > 0 {
+		end := uint64(size/sectsz) - 1
+		if end != h.Backup {
+			last := end - 1 - tabsect
+			for i := range t.Entries {
+				e := &t.Entries[i]
+				if !e.Empty() && e.Last > last {
+					return nil, fmt.Errorf("gpt: entry %d ends past the end of the disk", i+1)
+				}
+			}
+			change(BackupMoved, -1, "moved backup header from LBA %d to %d", h.Backup, end)
+			if last != h.Last {
+				change(UsableResized, -1, "changed last usable LBA from %d to %d", h.Last, last)
+			}
+			t.Header.Backup = end
+			t.Header.Last = last
+		}
+	}
+
+	t.MBR, err = mbr.Open(rw)
+	switch {
+	case err == mbr.ErrHeader:
+		change(MBRCorrupt, -1, "replaced MBR without a boot signature")
+		t.MBR = protectiveMBR(t.Header.Backup + 1)
+	case err != nil:
+		return nil, err
+	case ClassifyMBR(t.MBR) == LegacyMBR:
+		change(NoProtectiveMBR, -1, "created protective MBR")
+		t.MBR = protectiveMBR(t.Header.Backup + 1)
+	default:
+		fixProtective(t.MBR, h.Backup, t.Header.Backup, change)
+	}
+
+	if len(changes) == 0 {
+		return nil, nil
+	}
+	err = t.Write(rw)
+	if err != nil {
+		return changes, err
+	}
+
+	old := h.Backup
+	if old != t.Header.Backup && old > 1 && old < t.Header.Backup {
+		_, err = rw.WriteAt(make([]byte, sectsz), int64(old)*sectsz)
+	}
+	return changes, err
+}
+
+// two headers mirror each other if they only differ in
+// the fields that describe where each copy lives
+func (h *Header) mirrors(b *Header) bool {
+	x, y := *h, *b
+	x.Current, x.Backup, x.Table, x.Hdrcrc = 0, 0, 0, 0
+	y.Current, y.Backup, y.Table, y.Hdrcrc = 0, 0, 0, 0
+	return x == y && h.Current == b.Backup && h.Backup == b.Current
+}
+
+// in a hybrid MBR only a protective partition that used to reach
+// the old end of the disk is moved to the new one
+func fixProtective(m *mbr.Record, oldEnd, end uint64, change func(Kind, int, string, ...interface{})) {
+	size := protectiveSize(end + 1)
+	hybrid := ClassifyMBR(m) == HybridMBR
+	for i := range m.Part {
+		p := &m.Part[i]
+		if p.Type != 0xee || p.FirstLBA != 1 || uint64(p.NumSectors) == size {
+			continue
+		}
+		if hybrid && p.LastLBA < oldEnd {
+			continue
+		}
+		change(ProtectiveResized, i, "resized protective MBR slot %d from %d to %d sectors", i+1, p.NumSectors, size)
+		p.NumSectors = uint32(size)
+		p.LastLBA = size
+		p.End = mbr.DefaultGeometry.CHS(size)
+	}
+}
+
+func protectiveSize(nsect uint64) uint64 {
+	if nsect-1 > 0xffffffff {
+		return 0xffffffff
+	}
+	return nsect - 1
+}
+
+func protectiveMBR(nsect uint64) *mbr.Record {
+	size := protectiveSize(nsect)
+	m := &mbr.Record{
+		Sectsz: 512,
+		Part:   make([]mbr.Part, 4),
+	}
+	m.Part[0] = mbr.Part{
+		Start:      mbr.DefaultGeometry.CHS(1),
+		Type:       0xee,
+		End:        mbr.DefaultGeometry.CHS(size),
+		FirstLBA:   1,
+		NumSectors: uint32(size),
+		LastLBA:    size,
+	}
+	return m
+}
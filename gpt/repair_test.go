@@ -0,0 +1,62 @@
+package gpt
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+func TestRepairCorrupt(t *testing.T) {
+	for _, bad := range []Kind{PrimaryCorrupt, BackupCorrupt} {
+		d, tab := newDisk(t, 1<<20)
+		lba := uint64(1)
+		if bad == BackupCorrupt {
+			lba = tab.Header.Backup
+		}
+		d[int64(lba)*512+60] ^= 0xff
+
+		fs, err := Repair(d, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := kinds(fs); !reflect.DeepEqual(got, []Kind{bad}) {
+			t.Errorf("%v: Repair = %v", bad, fs)
+		}
+		if fs, err := Verify(d, nil); err != nil || len(fs) != 0 {
+			t.Errorf("%v: Verify after Repair = %v %v", bad, fs, err)
+		}
+		if fs, err := Repair(d, nil); err != nil || len(fs) != 0 {
+			t.Errorf("%v: second Repair = %v %v", bad, fs, err)
+		}
+	}
+}
+
+func TestRepairGrown(t *testing.T) {
+	small, tab := newDisk(t, 1<<20)
+	d := make(disk, 2<<20)
+	copy(d, small)
+	old := int64(tab.Header.Backup) * 512
+
+	fs, err := Repair(d, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Kind{BackupMoved, UsableResized, ProtectiveResized}
+	if got := kinds(fs); !reflect.DeepEqual(got, want) {
+		t.Errorf("Repair = %v, want %v", fs, want)
+	}
+	if !bytes.Equal(d[old:old+512], make([]byte, 512)) {
+		t.Errorf("old backup header was left on disk")
+	}
+
+	if fs, err := Verify(d, nil); err != nil || len(fs) != 0 {
+		t.Errorf("Verify after Repair = %v %v", fs, err)
+	}
+	rt, err := Open(d, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := uint64(len(d)/512) - 1; rt.Header.Backup != n {
+		t.Errorf("backup header at LBA %d, want %d", rt.Header.Backup, n)
+	}
+}
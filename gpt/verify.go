@@ -0,0 +1,270 @@
+package gpt
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"io"
+
+	"github.com/qeedquan/disktools/iod"
+	"github.com/qeedquan/disktools/mbr"
+)
+
+type Kind int
+
+const (
+	NoProtectiveMBR Kind = iota
+	MBRCorrupt
+	PrimaryCorrupt
+	BackupCorrupt
+	Mismatch
+	Overlap
+	OutOfBounds
+
+	// only reported by Repair
+	BackupMoved
+	UsableResized
+	ProtectiveResized
+)
+
+type Finding struct {
+	Kind  Kind
+	Entry int
+	Other int
+	Desc  string
+}
+
+type copyState struct {
+	header Header
+	raw    []byte
+	table  []byte
+	ok     bool
+	why    string
+}
+
+func (k Kind) String() string {
+	switch k {
+	case NoProtectiveMBR:
+		return "no protective MBR"
+	case MBRCorrupt:
+		return "MBR corrupt"
+	case PrimaryCorrupt:
+		return "primary corrupt"
+	case BackupCorrupt:
+		return "backup corrupt"
+	case Mismatch:
+		return "mismatch"
+	case Overlap:
+		return "overlap"
+	case OutOfBounds:
+		return "out of bounds"
+	case BackupMoved:
+		return "backup moved"
+	case UsableResized:
+		return "usable range resized"
+	case ProtectiveResized:
+		return "protective MBR resized"
+	}
+	return fmt.Sprintf("Kind(%d)", int(k))
+}
+
+func (f Finding) String() string {
+	return fmt.Sprintf("%v: %s", f.Kind, f.Desc)
+}
+
+// Verify checks both copies of the GPT against their CRCs and each other,
+// and checks the entries of the first intact copy for overlaps and bounds.
+// The returned error is only for I/O errors, problems with the table itself
+// are reported as findings.
+func Verify(r io.ReaderAt, o *Option) ([]Finding, error) {
+	var fs []Finding
+	add := func(k Kind, ent, other int, format string, args ...interface{}) {
+		fs = append(fs, Finding{
+			Kind:  k,
+			Entry: ent,
+			Other: other,
+			Desc:  fmt.Sprintf(format, args...),
+		})
+	}
+
+	m, err := mbr.Open(r)
+	switch {
+	case err == mbr.ErrHeader:
+		add(MBRCorrupt, -1, -1, "sector 0 has no boot signature")
+	case err != nil:
+		return nil, err
+	case ClassifyMBR(m) == LegacyMBR:
+		add(NoProtectiveMBR, -1, -1, "no MBR slot is of type 0xee")
+	}
+
+	_, pri, bak, err := readCopies(r, o)
+	if err != nil {
+		return nil, err
+	}
+	if !pri.ok {
+		add(PrimaryCorrupt, -1, -1, "%s", pri.why)
+	}
+	if bak == nil {
+		add(BackupCorrupt, -1, -1, "unable to locate backup header")
+	} else if !bak.ok {
+		add(BackupCorrupt, -1, -1, "%s", bak.why)
+	}
+
+	if pri.ok && bak != nil && bak.ok {
+		p, b := &pri.header, &bak.header
+		switch {
+		case p.Current != b.Backup || p.Backup != b.Current:
+			add(Mismatch, -1, -1, "headers do not point at each other (primary %d->%d, backup %d->%d)",
+				p.Current, p.Backup, b.Current, b.Backup)
+		case p.First != b.First || p.Last != b.Last:
+			add(Mismatch, -1, -1, "usable range differs (primary %d-%d, backup %d-%d)",
+				p.First, p.Last, b.First, b.Last)
+		case p.GUID != b.GUID:
+			add(Mismatch, -1, -1, "disk GUID differs (primary %v, backup %v)", p.GUID, b.GUID)
+		case p.Ent != b.Ent || p.Entsz != b.Entsz:
+			add(Mismatch, -1, -1, "entry layout differs (primary %dx%d, backup %dx%d)",
+				p.Ent, p.Entsz, b.Ent, b.Entsz)
+		}
+		if !bytes.Equal(pri.table, bak.table) {
+			add(Mismatch, -1, -1, "partition entry arrays differ")
+		}
+	}
+
+	good := pri
+	if !good.ok && bak != nil {
+		good = bak
+	}
+	if !good.ok {
+		return fs, nil
+	}
+
+	h := &good.header
+	ents := decodeEntries(good.table, h.Ent, h.Entsz)
+	for i := range ents {
+		e := &ents[i]
+		if e.Empty() {
+			continue
+		}
+		if e.First > e.Last || e.First < h.First || e.Last > h.Last {
+			add(OutOfBounds, i, -1, "entry %d (%d-%d) is outside of usable range %d-%d",
+				i, e.First, e.Last, h.First, h.Last)
+		}
+		for j := i + 1; j < len(ents); j++ {
+			f := &ents[j]
+			if f.Empty() {
+				continue
+			}
+			if e.First <= f.Last && f.First <= e.Last {
+				add(Overlap, i, j, "entry %d (%d-%d) overlaps entry %d (%d-%d)",
+					i, e.First, e.Last, j, f.First, f.Last)
+			}
+		}
+	}
+
+	return fs, nil
+}
+
+// the backup is found through the primary header if it is readable,
+// otherwise it is assumed to be on the last sector of the disk
+func readCopies(r io.ReaderAt, o *Option) (sectsz int64, pri, bak *copyState, err error) {
+	if o == nil {
+		o = &Option{}
+	}
+	sectsz = int64(o.Sectsz)
+	if sectsz == 0 {
+		n, err := DetectSectsz(r)
+		if err != nil {
+			n = 512
+		}
+		sectsz = int64(n)
+	}
+
+	size := diskSize(r, o)
+	pri, err = readCopy(r, sectsz, size, 1)
+	if err != nil {
+		return
+	}
+
+	lba := uint64(0)
+	if pri.header.sane() {
+		lba = pri.header.Backup
+	} else if size > 0 {
+		lba = uint64(size/sectsz) - 1
+	}
+	if lba != 0 {
+		bak, err = readCopy(r, sectsz, size, lba)
+	}
+	return
+}
+
+func (h *Header) sane() bool {
+	return string(h.Sig[:]) == "EFI PART" && h.Hdrsz >= 92 && h.Entsz >= 128
+}
+
+func readCopy(r io.ReaderAt, sectsz, size int64, lba uint64) (*copyState, error) {
+	c := &copyState{raw: make([]byte, sectsz)}
+	if lba >= lbaLimit(sectsz, size) {
+		c.why = fmt.Sprintf("header at LBA %d is past the end of the disk", lba)
+		return c, nil
+	}
+	_, err := r.ReadAt(c.raw, int64(lba)*sectsz)
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		c.why = fmt.Sprintf("header at LBA %d is past the end of the disk", lba)
+		return c, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	binary.Read(bytes.NewReader(c.raw), binary.LittleEndian, &c.header)
+	h := &c.header
+	switch {
+	case !h.sane():
+		c.why = fmt.Sprintf("invalid header at LBA %d", lba)
+		return c, nil
+	case int64(h.Hdrsz) > sectsz:
+		c.why = fmt.Sprintf("header size %d is larger than a sector", h.Hdrsz)
+		return c, nil
+	case h.Current != lba:
+		c.why = fmt.Sprintf("header at LBA %d claims to be at LBA %d", lba, h.Current)
+		return c, nil
+	}
+	if crc := headerCRC(c.raw[:h.Hdrsz]); crc != h.Hdrcrc {
+		c.why = fmt.Sprintf("header CRC mismatch (stored %#x, computed %#x)", h.Hdrcrc, crc)
+		return c, nil
+	}
+
+	c.table, err = readTable(r, sectsz, size, h)
+	switch err {
+	case nil:
+	case ErrEntrySize, ErrTableSize, ErrTruncated, ErrBounds:
+		c.why = err.Error()
+		return c, nil
+	default:
+		return nil, err
+	}
+	if crc := crc32.ChecksumIEEE(c.table); crc != h.Tabcrc {
+		c.why = fmt.Sprintf("table CRC mismatch (stored %#x, computed %#x)", h.Tabcrc, crc)
+		return c, nil
+	}
+	c.ok = true
+
+	return c, nil
+}
+
+// the header CRC is computed with the CRC field itself zeroed
+func headerCRC(b []byte) uint32 {
+	p := append([]byte{}, b...)
+	for i := 16; i < 20; i++ {
+		p[i] = 0
+	}
+	return crc32.ChecksumIEEE(p)
+}
+
+func diskSize(r io.ReaderAt, o *Option) int64 {
+	if o != nil && o.Size > 0 {
+		return o.Size
+	}
+	return iod.Size(r)
+}
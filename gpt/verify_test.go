@@ -0,0 +1,97 @@
+package gpt
+
+import (
+	"errors"
+	"io"
+	"reflect"
+	"testing"
+)
+
+// disk is an in-memory image that is fixed in size
+type disk []byte
+
+func (d disk) ReadAt(p []byte, off int64) (int, error) {
+	if off >= int64(len(d)) {
+		return 0, io.EOF
+	}
+	n := copy(p, d[off:])
+	if n < len(p) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+func (d disk) WriteAt(p []byte, off int64) (int, error) {
+	if off+int64(len(p)) > int64(len(d)) {
+		return 0, io.ErrShortWrite
+	}
+	return copy(d[off:], p), nil
+}
+
+func (d disk) Size() int64 { return int64(len(d)) }
+
+var efiSystem = MustParseGUID("C12A7328-F81F-11D2-BA4B-00A0C93EC93B")
+
+func newDisk(t *testing.T, size int64) (disk, *Table) {
+	d := make(disk, size)
+	tab, err := New(size, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = tab.Add(Entry{Part: efiSystem, First: tab.Header.First, Last: tab.Header.First + 99})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = tab.Write(d)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return d, tab
+}
+
+func kinds(fs []Finding) []Kind {
+	var k []Kind
+	for _, f := range fs {
+		k = append(k, f.Kind)
+	}
+	return k
+}
+
+func TestVerify(t *testing.T) {
+	tests := []struct {
+		name    string
+		corrupt func(d disk, tab *Table)
+		want    []Kind
+	}{
+		{"intact", func(disk, *Table) {}, nil},
+		{"primary header", func(d disk, tab *Table) { d[512+60] ^= 0xff }, []Kind{PrimaryCorrupt}},
+		{"backup header", func(d disk, tab *Table) { d[int64(tab.Header.Backup)*512+60] ^= 0xff }, []Kind{BackupCorrupt}},
+		{"primary table", func(d disk, tab *Table) { d[2*512] ^= 0xff }, []Kind{PrimaryCorrupt}},
+		{"MBR signature", func(d disk, tab *Table) { d[0x1fe] = 0 }, []Kind{MBRCorrupt}},
+		{"protective MBR", func(d disk, tab *Table) { d[0x1be+4] = 0x83 }, []Kind{NoProtectiveMBR}},
+	}
+	for _, tt := range tests {
+		d, tab := newDisk(t, 1<<20)
+		tt.corrupt(d, tab)
+		fs, err := Verify(d, nil)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if got := kinds(fs); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: got %v (%v), want %v", tt.name, got, fs, tt.want)
+		}
+	}
+}
+
+type badReader struct{}
+
+func (badReader) ReadAt(p []byte, off int64) (int, error) { return 0, errReadFailed }
+
+var errReadFailed = errors.New("read failed")
+
+func TestVerifyReadError(t *testing.T) {
+	fs, err := Verify(badReader{}, &Option{Sectsz: 512})
+	if err != errReadFailed {
+		t.Errorf("got %v %v, want %v", fs, err, errReadFailed)
+	}
+}
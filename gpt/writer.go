@@ -0,0 +1,218 @@
+package gpt
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"io"
+
+	"github.com/qeedquan/disktools/guid"
+	"github.com/qeedquan/disktools/mbr"
+)
+
+var (
+	ErrSize    = errors.New("gpt: disk too small")
+	ErrIndex   = errors.New("gpt: invalid entry index")
+	ErrFull    = errors.New("gpt: no free entries")
+	ErrRange   = errors.New("gpt: entry outside of usable range")
+	ErrOverlap = errors.New("gpt: entry overlaps another entry")
+	ErrType    = errors.New("gpt: entry has no partition type")
+)
+
+const (
+	headerSize  = 92
+	entrySize   = 128
+	numEntries  = 128
+	revision1_0 = 0x00010000
+)
+
+func NewGUID() GUID {
+	return guid.New()
+}
+
+// New creates an empty table with a protective MBR covering a disk of size bytes.
+func New(size int64, o *Option) (*Table, error) {
+	if o == nil {
+		o = &Option{}
+	}
+	sectsz := int64(o.Sectsz)
+	if sectsz == 0 {
+		sectsz = 512
+	}
+	nsect := uint64(size / sectsz)
+	tabsect := uint64((numEntries*entrySize + sectsz - 1) / sectsz)
+	if nsect < 3+2*tabsect {
+		return nil, ErrSize
+	}
+
+	t := &Table{
+		MBR:    protectiveMBR(nsect),
+		Sectsz: int(sectsz),
+		Header: Header{
+			Rev:     revision1_0,
+			Hdrsz:   headerSize,
+			Current: 1,
+			Backup:  nsect - 1,
+			First:   2 + tabsect,
+			Last:    nsect - 2 - tabsect,
+			GUID:    NewGUID(),
+			Table:   2,
+			Ent:     numEntries,
+			Entsz:   entrySize,
+		},
+		Entries: make([]Entry, numEntries),
+	}
+	copy(t.Header.Sig[:], "EFI PART")
+
+	return t, nil
+}
+
+// Add puts e in the first unused slot, a zero partition type
+// would leave the slot unused so it is rejected
+func (t *Table) Add(e Entry) (int, error) {
+	if e.Empty() {
+		return -1, ErrType
+	}
+	for i := range t.Entries {
+		if t.Entries[i].Empty() {
+			if e.Uniq == (GUID{}) {
+				e.Uniq = NewGUID()
+			}
+			err := t.check(i, e.First, e.Last)
+			if err != nil {
+				return -1, err
+			}
+			t.Entries[i] = e
+			return i, nil
+		}
+	}
+	return -1, ErrFull
+}
+
+func (t *Table) Delete(i int) error {
+	if !t.valid(i) {
+		return ErrIndex
+	}
+	t.Entries[i] = Entry{}
+	if i < len(t.Extra) {
+		t.Extra[i] = nil
+	}
+	return nil
+}
+
+func (t *Table) Resize(i int, first, last uint64) error {
+	if !t.valid(i) {
+		return ErrIndex
+	}
+	err := t.check(i, first, last)
+	if err != nil {
+		return err
+	}
+	t.Entries[i].First = first
+	t.Entries[i].Last = last
+	return nil
+}
+
+func (t *Table) Retype(i int, typ GUID) error {
+	if !t.valid(i) {
+		return ErrIndex
+	}
+	t.Entries[i].Part = typ
+	return nil
+}
+
+func (t *Table) Rename(i int, name string) error {
+	if !t.valid(i) {
+		return ErrIndex
+	}
+	return t.Entries[i].setName(name)
+}
+
+func (t *Table) valid(i int) bool {
+	return 0 <= i && i < len(t.Entries) && !t.Entries[i].Empty()
+}
+
+func (t *Table) check(i int, first, last uint64) error {
+	h := &t.Header
+	if first > last || first < h.First || last > h.Last {
+		return ErrRange
+	}
+	for j := range t.Entries {
+		e := &t.Entries[j]
+		if j != i && !e.Empty() && first <= e.Last && e.First <= last {
+			return ErrOverlap
+		}
+	}
+	return nil
+}
+
+// Write recomputes the CRCs and writes the protective MBR and both copies
+// of the header and entry array.
+func (t *Table) Write(w io.WriterAt) error {
+	sectsz := int64(t.Sectsz)
+	if t.MBR != nil {
+		err := mbr.Write(w, t.MBR, nil)
+		if err != nil {
+			return err
+		}
+	}
+
+	tab := t.encodeEntries()
+	t.Header.Tabcrc = crc32.ChecksumIEEE(tab)
+
+	// the backup entry array sits right before the backup header
+	pri := t.Header
+	bak := t.Header
+	bak.Current, bak.Backup = pri.Backup, pri.Current
+	bak.Table = pri.Backup - uint64((int64(len(tab))+sectsz-1)/sectsz)
+
+	for _, h := range []*Header{&pri, &bak} {
+		h.Hdrcrc = h.checksum()
+		b := make([]byte, sectsz)
+		copy(b, h.encode())
+		_, err := w.WriteAt(b, int64(h.Current)*sectsz)
+		if err != nil {
+			return err
+		}
+
+		_, err = w.WriteAt(tab, int64(h.Table)*sectsz)
+		if err != nil {
+			return err
+		}
+	}
+	t.Header.Hdrcrc = pri.Hdrcrc
+
+	return nil
+}
+
+func (t *Table) encodeEntries() []byte {
+	h := &t.Header
+	tab := make([]byte, int(h.Ent)*int(h.Entsz))
+	for i := range t.Entries {
+		if i >= int(h.Ent) {
+			break
+		}
+		w := new(bytes.Buffer)
+		binary.Write(w, binary.LittleEndian, &t.Entries[i])
+		copy(tab[i*int(h.Entsz):], w.Bytes())
+		if i < len(t.Extra) && h.Entsz > entrySize {
+			copy(tab[i*int(h.Entsz)+entrySize:(i+1)*int(h.Entsz)], t.Extra[i])
+		}
+	}
+	return tab
+}
+
+func (h *Header) encode() []byte {
+	w := new(bytes.Buffer)
+	binary.Write(w, binary.LittleEndian, h)
+	b := w.Bytes()
+	if int(h.Hdrsz) > len(b) {
+		b = append(b, make([]byte, int(h.Hdrsz)-len(b))...)
+	}
+	return b[:h.Hdrsz]
+}
+
+func (h *Header) checksum() uint32 {
+	return headerCRC(h.encode())
+}
@@ -0,0 +1,58 @@
+package gpt
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestAddZeroType(t *testing.T) {
+	tab, err := New(1<<20, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = tab.Add(Entry{First: tab.Header.First, Last: tab.Header.First})
+	if err != ErrType {
+		t.Errorf("Add with a zero type = %v, want %v", err, ErrType)
+	}
+}
+
+func TestWriteLayout(t *testing.T) {
+	d, tab := newDisk(t, 1<<20)
+
+	// shrink the usable range so the backup array no longer follows Last
+	// and make the entries larger than the 128 bytes Entry decodes
+	tab.Header.Last -= 100
+	tab.Header.Entsz = 256
+	tab.Header.Ent = 64
+	tab.Entries = tab.Entries[:64]
+	tab.Extra = make([][]byte, 64)
+	tab.Extra[0] = bytes.Repeat([]byte{0xab}, 128)
+	err := tab.Write(d)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fs, err := Verify(d, nil)
+	if err != nil || len(fs) != 0 {
+		t.Fatalf("Verify = %v %v", fs, err)
+	}
+
+	bak, err := readCopy(d, 512, d.Size(), tab.Header.Backup)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := tab.Header.Backup - 32; bak.header.Table != want {
+		t.Errorf("backup entry array at LBA %d, want %d", bak.header.Table, want)
+	}
+
+	rt, err := Open(d, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rt.Extra) != 64 || !bytes.Equal(rt.Extra[0], tab.Extra[0]) {
+		t.Errorf("extra entry bytes were not kept")
+	}
+	if rt.Entries[0] != tab.Entries[0] {
+		t.Errorf("entry 0 = %+v, want %+v", rt.Entries[0], tab.Entries[0])
+	}
+}
@@ -0,0 +1,110 @@
+package guid
+
+import (
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/qeedquan/disktools/endian"
+)
+
+// the first three fields are stored little endian and the
+// last two big endian, as used by EFI and partition tables
+type GUID [16]byte
+
+var (
+	ErrFormat = errors.New("guid: invalid format")
+)
+
+// random version 4 GUID, panics if the system has no randomness to offer
+func New() GUID {
+	var g GUID
+	_, err := rand.Read(g[:])
+	if err != nil {
+		panic("guid: " + err.Error())
+	}
+	endian.Put16le(g[6:], endian.Read16le(g[6:])&0x0fff|0x4000)
+	g[8] = g[8]&0x3f | 0x80
+	return g
+}
+
+// accepts both xxxxxxxx-xxxx-xxxx-xxxx-xxxxxxxxxxxx and the braced
+// {xxxxxxxx-xxxx-xxxx-xxxx-xxxxxxxxxxxx} form in any case
+func Parse(s string) (GUID, error) {
+	var g GUID
+	if strings.HasPrefix(s, "{") && strings.HasSuffix(s, "}") {
+		s = s[1 : len(s)-1]
+	}
+	if len(s) != 36 {
+		return g, ErrFormat
+	}
+
+	var b [16]byte
+	j := 0
+	for i := 0; i < len(s); {
+		switch i {
+		case 8, 13, 18, 23:
+			if s[i] != '-' {
+				return g, ErrFormat
+			}
+			i++
+			continue
+		}
+		hi, ok1 := unhex(s[i])
+		lo, ok2 := unhex(s[i+1])
+		if !ok1 || !ok2 {
+			return g, ErrFormat
+		}
+		b[j] = hi<<4 | lo
+		i, j = i+2, j+1
+	}
+
+	endian.Put32le(g[0:], endian.Read32be(b[0:]))
+	endian.Put16le(g[4:], endian.Read16be(b[4:]))
+	endian.Put16le(g[6:], endian.Read16be(b[6:]))
+	copy(g[8:], b[8:])
+	return g, nil
+}
+
+func MustParse(s string) GUID {
+	g, err := Parse(s)
+	if err != nil {
+		panic(err)
+	}
+	return g
+}
+
+func (g GUID) String() string {
+	return g.format("%08X-%04X-%04X-%04X-%012X")
+}
+
+func (g GUID) Lower() string {
+	return g.format("%08x-%04x-%04x-%04x-%012x")
+}
+
+func (g GUID) Braced() string {
+	return "{" + g.String() + "}"
+}
+
+func (g GUID) format(f string) string {
+	return fmt.Sprintf(f,
+		endian.Read32le(g[0:]),
+		endian.Read16le(g[4:]),
+		endian.Read16le(g[6:]),
+		endian.Read16be(g[8:]),
+		endian.Read48be(g[10:]),
+	)
+}
+
+func unhex(c byte) (byte, bool) {
+	switch {
+	case '0' <= c && c <= '9':
+		return c - '0', true
+	case 'a' <= c && c <= 'f':
+		return c - 'a' + 10, true
+	case 'A' <= c && c <= 'F':
+		return c - 'A' + 10, true
+	}
+	return 0, false
+}
@@ -0,0 +1,63 @@
+package guid
+
+import (
+	"testing"
+)
+
+func TestParseString(t *testing.T) {
+	// the EFI system partition type as stored on disk
+	esp := GUID{
+		0x28, 0x73, 0x2a, 0xc1, 0x1f, 0xf8, 0xd2, 0x11,
+		0xba, 0x4b, 0x00, 0xa0, 0xc9, 0x3e, 0xc9, 0x3b,
+	}
+	for _, s := range []string{
+		"C12A7328-F81F-11D2-BA4B-00A0C93EC93B",
+		"c12a7328-f81f-11d2-ba4b-00a0c93ec93b",
+		"{C12A7328-F81F-11D2-BA4B-00A0C93EC93B}",
+	} {
+		g, err := Parse(s)
+		if err != nil {
+			t.Fatalf("Parse(%q): %v", s, err)
+		}
+		if g != esp {
+			t.Errorf("Parse(%q) = % x, want % x", s, g[:], esp[:])
+		}
+	}
+
+	if s := esp.String(); s != "C12A7328-F81F-11D2-BA4B-00A0C93EC93B" {
+		t.Errorf("String = %s", s)
+	}
+	if s := esp.Lower(); s != "c12a7328-f81f-11d2-ba4b-00a0c93ec93b" {
+		t.Errorf("Lower = %s", s)
+	}
+	if s := esp.Braced(); s != "{C12A7328-F81F-11D2-BA4B-00A0C93EC93B}" {
+		t.Errorf("Braced = %s", s)
+	}
+
+	for i := 0; i < 100; i++ {
+		g := New()
+		for _, s := range []string{g.String(), g.Lower(), g.Braced()} {
+			h, err := Parse(s)
+			if err != nil || h != g {
+				t.Fatalf("Parse(%q) = %v %v, want %v", s, h, err, g)
+			}
+		}
+		if g[7]>>4 != 4 || g[8]>>6 != 2 {
+			t.Errorf("%v is not a version 4 GUID", g)
+		}
+	}
+}
+
+func TestParseInvalid(t *testing.T) {
+	for _, s := range []string{
+		"",
+		"C12A7328-F81F-11D2-BA4B-00A0C93EC93",
+		"C12A7328F81F-11D2-BA4B-00A0C93EC93B0",
+		"C12A7328-F81F-11D2-BA4B-00A0C93EC93G",
+		"{C12A7328-F81F-11D2-BA4B-00A0C93EC93B",
+	} {
+		if _, err := Parse(s); err != ErrFormat {
+			t.Errorf("Parse(%q) = %v, want %v", s, err, ErrFormat)
+		}
+	}
+}
@@ -1,6 +1,9 @@
 package iod
 
-import "io"
+import (
+	"io"
+	"os"
+)
 
 type RW interface {
 	io.ReaderAt
@@ -28,3 +31,23 @@ func (s *ORW) WriteAt(p []byte, off int64) (n int, err error) {
 func (s *ORW) Close() error {
 	return s.rw.Close()
 }
+
+// Size returns the size of the disk or image behind r, or 0 if it can't
+// be determined. Block devices don't report a size through Stat so they
+// are measured by seeking to the end.
+func Size(r io.ReaderAt) int64 {
+	switch r := r.(type) {
+	case interface{ Size() int64 }:
+		return r.Size()
+	case *os.File:
+		fi, err := r.Stat()
+		if err == nil && fi.Mode().IsRegular() {
+			return fi.Size()
+		}
+		n, err := r.Seek(0, io.SeekEnd)
+		if err == nil {
+			return n
+		}
+	}
+	return 0
+}
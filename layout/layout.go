@@ -0,0 +1,147 @@
+package layout
+
+import (
+	"errors"
+	"sort"
+
+	"github.com/qeedquan/disktools/gpt"
+	"github.com/qeedquan/disktools/mbr"
+)
+
+const DefaultAlign = 1 << 20
+
+var ErrSize = errors.New("layout: disk is smaller than a sector")
+
+type Extent struct {
+	First uint64
+	Last  uint64
+}
+
+// Num is the partition number as printed by diskinfo, starting from 1
+type Misaligned struct {
+	Num   int
+	First uint64
+}
+
+type Report struct {
+	Sectsz     int
+	Align      uint64
+	First      uint64
+	Last       uint64
+	Free       []Extent
+	Largest    Extent
+	Misaligned []Misaligned
+}
+
+type part struct {
+	num     int
+	noalign bool
+	Extent
+}
+
+func (e Extent) Size() uint64 {
+	if e.Last < e.First {
+		return 0
+	}
+	return e.Last - e.First + 1
+}
+
+// align is in bytes, zero uses DefaultAlign
+func GPT(t *gpt.Table, align uint64) *Report {
+	var parts []part
+	for i := range t.Entries {
+		e := &t.Entries[i]
+		if !e.Empty() {
+			parts = append(parts, part{i + 1, false, Extent{e.First, e.Last}})
+		}
+	}
+	return analyze(t.Sectsz, align, t.Header.First, t.Header.Last, parts)
+}
+
+// size is the size of the disk in bytes, zero assumes the disk
+// ends with the last partition. Space inside an extended partition
+// is considered allocated.
+func MBR(r *mbr.Record, size int64, align uint64) (*Report, error) {
+	if r.Sectsz <= 0 || size < 0 || size > 0 && size < int64(r.Sectsz) {
+		return nil, ErrSize
+	}
+
+	var (
+		parts []part
+		last  uint64
+	)
+	add := func(num int, p *mbr.Part) {
+		if p.Empty() || p.NumSectors == 0 {
+			return
+		}
+		// protective partitions always start at LBA 1
+		parts = append(parts, part{num, p.Type == 0xee, Extent{uint64(p.FirstLBA), p.LastLBA}})
+		if p.LastLBA > last {
+			last = p.LastLBA
+		}
+	}
+	for i := range r.Part {
+		add(i+1, &r.Part[i])
+	}
+	for i := range r.Logical {
+		add(i+5, &r.Logical[i])
+	}
+
+	if size > 0 {
+		last = uint64(size/int64(r.Sectsz)) - 1
+	}
+	return analyze(r.Sectsz, align, 1, last, parts), nil
+}
+
+func analyze(sectsz int, align, first, last uint64, parts []part) *Report {
+	if align == 0 {
+		align = DefaultAlign
+	}
+	r := &Report{
+		Sectsz: sectsz,
+		Align:  align,
+		First:  first,
+		Last:   last,
+	}
+
+	sort.Slice(parts, func(i, j int) bool {
+		return parts[i].First < parts[j].First
+	})
+
+	pos := first
+	for _, p := range parts {
+		if !p.noalign && (p.First*uint64(sectsz))%align != 0 {
+			r.Misaligned = append(r.Misaligned, Misaligned{p.num, p.First})
+		}
+		if p.First > pos && pos <= last {
+			end := p.First - 1
+			if end > last {
+				end = last
+			}
+			r.addFree(Extent{pos, end})
+		}
+		if p.Last+1 > pos {
+			pos = p.Last + 1
+		}
+	}
+	if pos <= last {
+		r.addFree(Extent{pos, last})
+	}
+
+	return r
+}
+
+func (r *Report) addFree(e Extent) {
+	r.Free = append(r.Free, e)
+	if e.Size() > r.Largest.Size() {
+		r.Largest = e
+	}
+}
+
+func (r *Report) FreeSectors() uint64 {
+	var n uint64
+	for _, e := range r.Free {
+		n += e.Size()
+	}
+	return n
+}
@@ -0,0 +1,99 @@
+package layout
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/qeedquan/disktools/gpt"
+	"github.com/qeedquan/disktools/mbr"
+)
+
+var linuxData = gpt.MustParseGUID("0FC63DAF-8483-4772-8E79-3D69D8477DE4")
+
+func TestGPT(t *testing.T) {
+	tab, err := gpt.New(16<<20, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, e := range []gpt.Entry{
+		{Part: linuxData, First: 2048, Last: 4095},
+		{Part: linuxData, First: 4096, Last: 6143},
+		{Part: linuxData, First: 10000, Last: 12000},
+	} {
+		_, err = tab.Add(e)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	r := GPT(tab, 0)
+	free := []Extent{{34, 2047}, {6144, 9999}, {12001, 32734}}
+	if !reflect.DeepEqual(r.Free, free) {
+		t.Errorf("free %v, want %v", r.Free, free)
+	}
+	if r.Largest != free[2] {
+		t.Errorf("largest %v, want %v", r.Largest, free[2])
+	}
+	if want := []Misaligned{{3, 10000}}; !reflect.DeepEqual(r.Misaligned, want) {
+		t.Errorf("misaligned %v, want %v", r.Misaligned, want)
+	}
+	if n, want := r.FreeSectors(), uint64(2014+3856+20734); n != want {
+		t.Errorf("%d free sectors, want %d", n, want)
+	}
+
+	// 4K alignment only needs a multiple of 8 sectors
+	if r := GPT(tab, 4096); len(r.Misaligned) != 0 {
+		t.Errorf("4K misaligned %v", r.Misaligned)
+	}
+}
+
+func mbrPart(typ uint8, first, n uint32) mbr.Part {
+	return mbr.Part{Type: typ, FirstLBA: first, NumSectors: n, LastLBA: uint64(first) + uint64(n) - 1}
+}
+
+func TestMBR(t *testing.T) {
+	m := &mbr.Record{Sectsz: 512, Part: []mbr.Part{
+		mbrPart(0x83, 2048, 3000),
+		mbrPart(0x83, 4000, 2001),
+		{},
+		mbrPart(0x05, 8192, 4096),
+	}}
+	m.Logical = []mbr.Part{mbrPart(0x83, 8200, 100)}
+
+	tests := []struct {
+		size int64
+		last uint64
+		free []Extent
+	}{
+		{0, 12287, []Extent{{1, 2047}, {6001, 8191}}},
+		{16 << 20, 32767, []Extent{{1, 2047}, {6001, 8191}, {12288, 32767}}},
+	}
+	for _, tt := range tests {
+		r, err := MBR(m, tt.size, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if r.Last != tt.last || !reflect.DeepEqual(r.Free, tt.free) {
+			t.Errorf("size %d: last %d free %v, want %d %v", tt.size, r.Last, r.Free, tt.last, tt.free)
+		}
+		if want := []Misaligned{{2, 4000}, {5, 8200}}; !reflect.DeepEqual(r.Misaligned, want) {
+			t.Errorf("size %d: misaligned %v, want %v", tt.size, r.Misaligned, want)
+		}
+	}
+
+	// the protective partition isn't expected to be aligned
+	p := &mbr.Record{Sectsz: 512, Part: []mbr.Part{mbrPart(0xee, 1, 2047)}}
+	r, err := MBR(p, 1<<20, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(r.Misaligned) != 0 || len(r.Free) != 0 {
+		t.Errorf("protective: misaligned %v free %v", r.Misaligned, r.Free)
+	}
+
+	for _, size := range []int64{1, 511, -1} {
+		if _, err := MBR(m, size, 0); err != ErrSize {
+			t.Errorf("size %d: got %v, want %v", size, err, ErrSize)
+		}
+	}
+}
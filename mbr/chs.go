@@ -0,0 +1,134 @@
+package mbr
+
+import (
+	"errors"
+	"fmt"
+)
+
+type Geometry struct {
+	Heads   uint64
+	Sectors uint64
+}
+
+type CHSMismatch struct {
+	Num       int
+	Part      Part
+	WantStart CHS
+	WantEnd   CHS
+}
+
+var (
+	ErrGeometry = errors.New("mbr: invalid geometry")
+	ErrCHS      = errors.New("mbr: invalid CHS address")
+)
+
+var DefaultGeometry = Geometry{Heads: 255, Sectors: 63}
+
+func (g *Geometry) valid() bool {
+	return 0 < g.Heads && g.Heads <= 255 && 0 < g.Sectors && g.Sectors <= 63
+}
+
+// addresses past cylinder 1023 are clamped to the maximum CHS value,
+// which tells the BIOS to use the LBA fields instead
+func (g *Geometry) CHS(lba uint64) CHS {
+	if !g.valid() {
+		return CHS{}
+	}
+	c := lba / (g.Heads * g.Sectors)
+	if c > 1023 {
+		return CHS{Head: g.Heads - 1, Sector: g.Sectors, Cylinder: 1023}
+	}
+	return CHS{
+		Head:     (lba / g.Sectors) % g.Heads,
+		Sector:   lba%g.Sectors + 1,
+		Cylinder: c,
+	}
+}
+
+func (g *Geometry) LBA(c CHS) (uint64, error) {
+	if !g.valid() {
+		return 0, ErrGeometry
+	}
+	if c.Sector < 1 || c.Sector > g.Sectors || c.Head >= g.Heads || c.Cylinder > 1023 {
+		return 0, ErrCHS
+	}
+	return (c.Cylinder*g.Heads+c.Head)*g.Sectors + c.Sector - 1, nil
+}
+
+// a clamped address only has to agree on the cylinder, since tools
+// disagree on which head and sector to use for it
+func (g *Geometry) match(c CHS, lba uint64) bool {
+	want := g.CHS(lba)
+	if want.Cylinder == 1023 && c.Cylinder == 1023 {
+		return true
+	}
+	return c == want
+}
+
+// InferGeometry guesses the geometry the table was written with from the
+// largest head and sector numbers in the CHS fields, partitioning tools
+// end partitions on a cylinder boundary so those are the last head and
+// sector of a cylinder. ok is false if no entry has usable CHS fields.
+func (r *Record) InferGeometry() (g Geometry, ok bool) {
+	scan := func(p *Part) {
+		if p.Empty() || p.NumSectors == 0 || p.Type == 0xee {
+			return
+		}
+		for _, c := range []CHS{p.Start, p.End} {
+			if c.Head+1 > g.Heads {
+				g.Heads = c.Head + 1
+			}
+			if c.Sector > g.Sectors {
+				g.Sectors = c.Sector
+			}
+		}
+	}
+	for i := range r.Part {
+		scan(&r.Part[i])
+	}
+	for i := range r.Logical {
+		scan(&r.Logical[i])
+	}
+	return g, g.valid()
+}
+
+func (r *Record) CheckCHS(g *Geometry) ([]CHSMismatch, error) {
+	if !g.valid() {
+		return nil, ErrGeometry
+	}
+
+	// protective GPT entries are ignored by firmware and are commonly
+	// written with an end CHS of 0xffffff regardless of the disk size
+	var m []CHSMismatch
+	check := func(n int, p *Part) {
+		if p.Empty() || p.NumSectors == 0 || p.Type == 0xee {
+			return
+		}
+		first := uint64(p.FirstLBA)
+		if !g.match(p.Start, first) || !g.match(p.End, p.LastLBA) {
+			m = append(m, CHSMismatch{
+				Num:       n,
+				Part:      *p,
+				WantStart: g.CHS(first),
+				WantEnd:   g.CHS(p.LastLBA),
+			})
+		}
+	}
+	for i := range r.Part {
+		check(i+1, &r.Part[i])
+	}
+	for i := range r.Logical {
+		check(i+5, &r.Logical[i])
+	}
+	return m, nil
+}
+
+func (m *CHSMismatch) String() string {
+	return fmt.Sprintf("partition %d: CHS (%d,%d,%d)-(%d,%d,%d) does not match LBA %d-%d, expected (%d,%d,%d)-(%d,%d,%d)",
+		m.Num,
+		m.Part.Start.Cylinder, m.Part.Start.Head, m.Part.Start.Sector,
+		m.Part.End.Cylinder, m.Part.End.Head, m.Part.End.Sector,
+		m.Part.FirstLBA, m.Part.LastLBA,
+		m.WantStart.Cylinder, m.WantStart.Head, m.WantStart.Sector,
+		m.WantEnd.Cylinder, m.WantEnd.Head, m.WantEnd.Sector)
+}
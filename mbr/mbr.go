@@ -2,14 +2,25 @@ package mbr
 
 import (
 	"errors"
+	"fmt"
 	"io"
 
 	"github.com/qeedquan/disktools/endian"
 )
 
 type Record struct {
-	Sectsz int
-	Part   []Part
+	Sectsz   int
+	Bootcode [440]byte
+	Sig      uint32
+	Protect  uint16
+
+	// Part always holds the four primary slots, unused ones are Empty
+	Part    []Part
+	Logical []Part
+
+	// ChainErr is set when an extended partition chain could not be
+	// followed to its end, Logical holds what was read before that
+	ChainErr error
 }
 
 type Part struct {
@@ -30,6 +41,8 @@ type CHS struct {
 
 var (
 	ErrHeader = errors.New("mbr: invalid boot signature")
+	ErrLoop   = errors.New("mbr: extended partition chain loops")
+	ErrBounds = errors.New("mbr: extended partition chain out of bounds")
 )
 
 func Open(r io.ReaderAt) (*Record, error) {
@@ -45,33 +58,105 @@ func Open(r io.ReaderAt) (*Record, error) {
 
 	var parts []Part
 	for i := 0; i < 4; i++ {
-		part := readPart(mbr[0x1be+i*16:])
-		if part.Type == 0 {
+		parts = append(parts, readPart(mbr[0x1be+i*16:]))
+	}
+
+	rec := &Record{
+		Sectsz:  512,
+		Sig:     endian.Read32le(mbr[0x1b8:]),
+		Protect: endian.Read16le(mbr[0x1bc:]),
+		Part:    parts,
+	}
+	copy(rec.Bootcode[:], mbr[:])
+	for i := range parts {
+		if !IsExtended(parts[i].Type) {
 			continue
 		}
-		parts = append(parts, part)
+		logical, err := readLogical(r, &parts[i])
+		rec.Logical = append(rec.Logical, logical...)
+		if err != nil && rec.ChainErr == nil {
+			rec.ChainErr = err
+		}
 	}
 
-	return &Record{
-		Sectsz: 512,
-		Part:   parts,
-	}, nil
+	return rec, nil
+}
+
+func (r *Record) DiskID() string {
+	return fmt.Sprintf("%08x", r.Sig)
+}
+
+// partitions are numbered like Linux does, 1-4 for primary and 5+ for logical
+func (r *Record) PartUUID(n int) string {
+	return fmt.Sprintf("%08x-%02x", r.Sig, n)
+}
+
+func IsExtended(typ uint8) bool {
+	switch typ {
+	case 0x05, 0x0f, 0x85:
+		return true
+	}
+	return false
+}
+
+// each EBR describes one logical partition relative to itself
+// and links to the next EBR relative to the start of the extended partition,
+// on error the partitions found before the bad EBR are returned
+func readLogical(r io.ReaderAt, ext *Part) ([]Part, error) {
+	var (
+		parts []Part
+		ebr   [512]byte
+	)
+	if ext.NumSectors == 0 {
+		return nil, nil
+	}
+
+	base := uint64(ext.FirstLBA)
+	seen := make(map[uint64]bool)
+	for lba := base; ; {
+		if lba > ext.LastLBA {
+			return parts, ErrBounds
+		}
+		if seen[lba] {
+			return parts, ErrLoop
+		}
+		seen[lba] = true
+
+		_, err := r.ReadAt(ebr[:], int64(lba)*512)
+		if err != nil {
+			return parts, err
+		}
+		if ebr[0x1fe] != 0x55 || ebr[0x1ff] != 0xaa {
+			return parts, ErrHeader
+		}
+
+		part := readPart(ebr[0x1be:])
+		if part.Type != 0 && part.NumSectors != 0 {
+			first := lba + uint64(part.FirstLBA)
+			if first > ext.LastLBA || first+uint64(part.NumSectors)-1 > ext.LastLBA {
+				return parts, ErrBounds
+			}
+			part.FirstLBA = uint32(first)
+			part.LastLBA = part.calcLastLBA()
+			parts = append(parts, part)
+		}
+
+		next := readPart(ebr[0x1ce:])
+		if !IsExtended(next.Type) || next.FirstLBA == 0 {
+			break
+		}
+		lba = base + uint64(next.FirstLBA)
+	}
+
+	return parts, nil
 }
 
 func readPart(b []byte) Part {
 	p := Part{
-		Bootable: b[0],
-		Start: CHS{
-			Head:     uint64(b[1]),
-			Sector:   uint64(b[2]) & 0xbf,
-			Cylinder: uint64(b[2])<<8 | uint64(b[3]),
-		},
-		Type: b[4],
-		End: CHS{
-			Head:     uint64(b[5]),
-			Sector:   uint64(b[6]) & 0xbf,
-			Cylinder: uint64(b[6])<<8 | uint64(b[7]),
-		},
+		Bootable:   b[0],
+		Start:      readCHS(b[1:]),
+		Type:       b[4],
+		End:        readCHS(b[5:]),
 		FirstLBA:   endian.Read32le(b[8:]),
 		NumSectors: endian.Read32le(b[12:]),
 	}
@@ -79,6 +164,19 @@ func readPart(b []byte) Part {
 	return p
 }
 
+// the top two bits of the sector byte are bits 8-9 of the cylinder
+func readCHS(b []byte) CHS {
+	return CHS{
+		Head:     uint64(b[0]),
+		Sector:   uint64(b[1]) & 0x3f,
+		Cylinder: uint64(b[1]&0xc0)<<2 | uint64(b[2]),
+	}
+}
+
+func (p *Part) Empty() bool {
+	return p.Type == 0
+}
+
 func (p *Part) calcLastLBA() uint64 {
 	if p.NumSectors > 0 {
 		return uint64(p.FirstLBA) + uint64(p.NumSectors) - 1
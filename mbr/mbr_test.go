@@ -0,0 +1,91 @@
+package mbr
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/qeedquan/disktools/endian"
+)
+
+func putEntry(b []byte, typ uint8, first, n uint32) {
+	b[4] = typ
+	endian.Put32le(b[8:], first)
+	endian.Put32le(b[12:], n)
+}
+
+func TestOpenBadChain(t *testing.T) {
+	img := make([]byte, 300*512)
+	img[0x1fe], img[0x1ff] = 0x55, 0xaa
+	putEntry(img[0x1be:], 0x83, 10, 50)
+	putEntry(img[0x1ce:], 0x05, 100, 100)
+	putEntry(img[0x1de:], 0x0f, 250, 0)
+
+	// the first EBR links to a second one without a boot signature
+	ebr := img[100*512:]
+	ebr[0x1fe], ebr[0x1ff] = 0x55, 0xaa
+	putEntry(ebr[0x1be:], 0x83, 1, 10)
+	putEntry(ebr[0x1ce:], 0x05, 20, 30)
+
+	m, err := Open(bytes.NewReader(img))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(m.Part) != 4 || m.Part[0].FirstLBA != 10 {
+		t.Errorf("primary partitions not kept: %+v", m.Part)
+	}
+	if len(m.Logical) != 1 || m.Logical[0].FirstLBA != 101 || m.Logical[0].LastLBA != 110 {
+		t.Errorf("logical partitions = %+v", m.Logical)
+	}
+	if m.ChainErr != ErrHeader {
+		t.Errorf("ChainErr = %v, want %v", m.ChainErr, ErrHeader)
+	}
+}
+
+func TestInferGeometry(t *testing.T) {
+	var zero Geometry
+	if c := zero.CHS(100); c != (CHS{}) {
+		t.Errorf("zero geometry CHS = %+v", c)
+	}
+
+	g := Geometry{Heads: 16, Sectors: 63}
+	r := &Record{Part: make([]Part, 4)}
+	r.Part[0] = Part{Type: 0x83, FirstLBA: 63, NumSectors: 16*63*10 - 63}
+	r.Part[1] = Part{Type: 0x83, FirstLBA: 16 * 63 * 10, NumSectors: 16 * 63 * 20}
+	b, err := Encode(r, &g)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err = Open(bytes.NewReader(append(b, make([]byte, 512)...)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ig, ok := r.InferGeometry()
+	if !ok || ig != g {
+		t.Fatalf("InferGeometry = %+v %v, want %+v", ig, ok, g)
+	}
+	if m, _ := r.CheckCHS(&ig); len(m) != 0 {
+		t.Errorf("CheckCHS with the inferred geometry: %v", m)
+	}
+	if m, _ := r.CheckCHS(&DefaultGeometry); len(m) == 0 {
+		t.Errorf("CheckCHS with the default geometry found no mismatches")
+	}
+}
+
+func TestEncodeZeroLength(t *testing.T) {
+	g := Geometry{Heads: 255, Sectors: 63}
+	r := &Record{Part: make([]Part, 4)}
+	r.Part[0] = Part{Type: 0x83, FirstLBA: 2048}
+	if _, err := Encode(r, &g); err != ErrLength {
+		t.Errorf("zero length entry: got %v, want %v", err, ErrLength)
+	}
+
+	// without a geometry the entry is written out as is
+	b, err := Encode(r, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b[0x1c2] != 0x83 || endian.Read32le(b[0x1c6:]) != 2048 {
+		t.Errorf("entry not kept: % x", b[0x1be:0x1ce])
+	}
+}
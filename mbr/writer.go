@@ -0,0 +1,78 @@
+package mbr
+
+import (
+	"errors"
+	"io"
+
+	"github.com/qeedquan/disktools/endian"
+)
+
+var (
+	ErrTooMany = errors.New("mbr: too many primary partitions")
+	ErrRange   = errors.New("mbr: partition does not fit in 32-bit LBA")
+	ErrLength  = errors.New("mbr: partition has no sectors")
+)
+
+// if g is nil the CHS fields of each partition are written out as is,
+// otherwise they are recomputed from the LBA fields
+func Encode(r *Record, g *Geometry) ([]byte, error) {
+	if len(r.Part) > 4 {
+		return nil, ErrTooMany
+	}
+	if g != nil && !g.valid() {
+		return nil, ErrGeometry
+	}
+
+	b := make([]byte, 512)
+	copy(b, r.Bootcode[:])
+	endian.Put32le(b[0x1b8:], r.Sig)
+	endian.Put16le(b[0x1bc:], r.Protect)
+	for i := range r.Part {
+		p := r.Part[i]
+		if !p.Empty() && g != nil {
+			if p.NumSectors == 0 {
+				return nil, ErrLength
+			}
+			if uint64(p.FirstLBA)+uint64(p.NumSectors) > 1<<32 {
+				return nil, ErrRange
+			}
+			p.Start = g.CHS(uint64(p.FirstLBA))
+			p.End = g.CHS(uint64(p.FirstLBA) + uint64(p.NumSectors) - 1)
+		}
+		writePart(b[0x1be+i*16:], &p)
+	}
+	b[0x1fe] = 0x55
+	b[0x1ff] = 0xaa
+
+	return b, nil
+}
+
+func Write(w io.WriterAt, r *Record, g *Geometry) error {
+	b, err := Encode(r, g)
+	if err != nil {
+		return err
+	}
+	_, err = w.WriteAt(b, 0)
+	return err
+}
+
+func writePart(b []byte, p *Part) {
+	if p.Empty() {
+		for i := 0; i < 16; i++ {
+			b[i] = 0
+		}
+		return
+	}
+	b[0] = p.Bootable
+	putCHS(b[1:], p.Start)
+	b[4] = p.Type
+	putCHS(b[5:], p.End)
+	endian.Put32le(b[8:], p.FirstLBA)
+	endian.Put32le(b[12:], p.NumSectors)
+}
+
+func putCHS(b []byte, c CHS) {
+	b[0] = uint8(c.Head)
+	b[1] = uint8(c.Sector&0x3f) | uint8(c.Cylinder>>8&0x3)<<6
+	b[2] = uint8(c.Cylinder)
+}